@@ -21,12 +21,40 @@ type (
 		Conn string
 	}
 
+	BlobConfig struct {
+		Store            string          `default:"postgres"` // postgres, fs or s3
+		Dir              string          `default:"/var/lib/doc_server/blobs"` // fs store root
+		S3Endpoint       string          `envconfig:"S3_ENDPOINT"` // e.g. http://localhost:9000
+		S3Region         string          `envconfig:"S3_REGION" default:"us-east-1"`
+		S3Bucket         string          `envconfig:"S3_BUCKET"`
+		S3AccessKey      string          `envconfig:"S3_ACCESS_KEY"`
+		S3SecretKey      string          `envconfig:"S3_SECRET_KEY"`
+		S3Timeout        time.Duration   `envconfig:"S3_TIMEOUT" default:"30s"` // connecting and waiting for response headers
+		S3RequestTimeout time.Duration   `envconfig:"S3_REQUEST_TIMEOUT" default:"1h"` // whole request, bodies of blobs included
+	}
+
+	DocsConfig struct {
+		PublicRateLimit  int             `envconfig:"PUBLIC_RATE_LIMIT" default:"60"` // anonymous requests per minute from one address
+		LinkSecret       string          `envconfig:"LINK_SECRET"` // share links signing key, random if empty
+		LinkTTL          time.Duration   `envconfig:"LINK_TTL" default:"24h"`
+		MaxVersions      int             `envconfig:"MAX_VERSIONS" default:"10"` // previous versions kept per document by default
+		MaxFileSize      int64           `envconfig:"MAX_FILE_SIZE" default:"1073741824"` // form upload limit in bytes, 1 GB
+		MaxJSONSize      int64           `envconfig:"MAX_JSON_SIZE" default:"4194304"` // json document and patch limit in bytes, 4 MB, they are read in memory
+		UploadMaxSize    int64           `envconfig:"UPLOAD_MAX_SIZE" default:"10737418240"` // resumable upload limit in bytes, 10 GB
+		UploadTTL        time.Duration   `envconfig:"UPLOAD_TTL" default:"24h"` // unfinished uploads are removed after
+		TrashTTL         time.Duration   `envconfig:"TRASH_TTL" default:"720h"` // deleted documents are purged after
+		MimeAllow        []string        `envconfig:"MIME_ALLOW"` // comma separated types or type/*, any if empty
+		MimeDeny         []string        `envconfig:"MIME_DENY"` // checked before allow list
+		Blob             BlobConfig      // file contents storage
+	}
+
 	AppConfig struct {
 		Environment      string
 		LogLevel         string          `envconfig:"LOG_LEVEL" default:"DEBUG"`
 		PG               PGConfig
 		Web              WebConfig
 		Rpc              RPCConfig
+		Docs             DocsConfig
 		AdminToken       string          `envconfig:"ADMIN_TOKEN"`
 		ShutdownTimeout  time.Duration   `envconfig:"SHUTDOWN_TIMEOUT" default:"30s"`
 	}
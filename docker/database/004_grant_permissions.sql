@@ -0,0 +1,27 @@
+\c doc_server
+
+-- grants become objects of login and permission, [{"login": ..., "permission": "read" | "write" | "share"}].
+-- Bare logins granted so far become read grants, documents with no grants get an empty list
+
+BEGIN;
+
+ALTER TABLE docs.meta DISABLE TRIGGER updated_at_docs_trgr;
+
+UPDATE docs.meta SET grant_logins = '[]' WHERE grant_logins IS NULL OR jsonb_typeof(grant_logins) <> 'array';
+
+UPDATE docs.meta SET grant_logins = (
+	SELECT COALESCE(jsonb_agg(
+		CASE
+			WHEN jsonb_typeof(item) = 'string' THEN jsonb_build_object('login', item #>> '{}', 'permission', 'read')
+			ELSE item
+		END ORDER BY n), '[]')
+	FROM jsonb_array_elements(grant_logins) WITH ORDINALITY AS grants(item, n)
+)
+WHERE EXISTS (SELECT 1 FROM jsonb_array_elements(grant_logins) AS items(item) WHERE jsonb_typeof(item) = 'string');
+
+ALTER TABLE docs.meta ALTER COLUMN grant_logins SET DEFAULT '[]';
+ALTER TABLE docs.meta ALTER COLUMN grant_logins SET NOT NULL;
+
+ALTER TABLE docs.meta ENABLE TRIGGER updated_at_docs_trgr;
+
+COMMIT;
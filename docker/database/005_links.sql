@@ -0,0 +1,25 @@
+\c doc_server
+
+-- signed share links of documents, expiring and limited in downloads
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS docs.links
+(
+	id                 varchar(256) UNIQUE NOT NULL,
+	doc_id             varchar(256) NOT NULL REFERENCES docs.meta(id) ON DELETE CASCADE,
+	owner_login        varchar(256) NOT NULL, -- who shared the link
+	expires_at         timestamptz NOT NULL,
+	max_downloads      int DEFAULT NULL, -- unlimited
+	downloads          int NOT NULL DEFAULT 0,
+	password           text DEFAULT NULL, -- bcrypt hash
+	revoked            bool NOT NULL DEFAULT false,
+	created_at         timestamptz NOT NULL DEFAULT NOW(),
+	PRIMARY KEY(id)
+);
+
+CREATE INDEX IF NOT EXISTS links_doc_id_idx ON docs.links(doc_id);
+
+GRANT INSERT, UPDATE, DELETE, SELECT ON docs.links TO doc_server_admin;
+
+COMMIT;
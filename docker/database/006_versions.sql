@@ -0,0 +1,28 @@
+\c doc_server
+
+-- previous contents of documents are kept as versions.
+-- Documents kept so far start at version 1 with no history
+
+BEGIN;
+
+ALTER TABLE docs.meta ADD COLUMN version int NOT NULL DEFAULT 1; -- current content version
+ALTER TABLE docs.meta ADD COLUMN max_versions int DEFAULT NULL; -- previous versions to keep, server default if null
+
+CREATE TABLE IF NOT EXISTS docs.versions
+(
+	doc_id             varchar(256) NOT NULL REFERENCES docs.meta(id) ON DELETE CASCADE,
+	version            int NOT NULL,
+	oid                int UNIQUE DEFAULT NULL, -- large object id
+	name               varchar(256) NOT NULL,
+	file               bool NOT NULL,
+	json               bytea DEFAULT NULL,
+	mime               varchar(256) NOT NULL,
+	size               bigint NOT NULL,
+	created_at         timestamptz NOT NULL, -- when content was saved
+	archived_at        timestamptz NOT NULL DEFAULT NOW(), -- when content was replaced
+	PRIMARY KEY(doc_id, version)
+);
+
+GRANT INSERT, UPDATE, DELETE, SELECT ON docs.versions TO doc_server_admin;
+
+COMMIT;
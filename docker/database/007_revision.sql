@@ -0,0 +1,9 @@
+\c doc_server
+
+-- revision is bumped on every change of document and makes its etag
+
+BEGIN;
+
+ALTER TABLE docs.meta ADD COLUMN revision bigint NOT NULL DEFAULT 1; -- bumped on every change, makes etag
+
+COMMIT;
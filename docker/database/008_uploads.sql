@@ -0,0 +1,27 @@
+\c doc_server
+
+-- resumable uploads, chunks are written to large object until length is reached
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS docs.uploads
+(
+	id                 varchar(256) UNIQUE NOT NULL,
+	doc_id             varchar(256) NOT NULL, -- document created on completion
+	oid                int UNIQUE NOT NULL, -- large object chunks are written to
+	owner_login        varchar(256) NOT NULL,
+	name               varchar(256) NOT NULL,
+	mime               varchar(256) NOT NULL,
+	public             bool NOT NULL DEFAULT false,
+	length             bigint NOT NULL,
+	"offset"           bigint NOT NULL DEFAULT 0,
+	expires_at         timestamptz NOT NULL,
+	created_at         timestamptz NOT NULL DEFAULT NOW(),
+	PRIMARY KEY(id)
+);
+
+CREATE INDEX IF NOT EXISTS uploads_expires_at_idx ON docs.uploads(expires_at);
+
+GRANT INSERT, UPDATE, DELETE, SELECT ON docs.uploads TO doc_server_admin;
+
+COMMIT;
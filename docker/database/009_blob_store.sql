@@ -0,0 +1,55 @@
+\c doc_server
+
+-- file contents move from large objects referenced by oid to blob store keys.
+-- Large objects kept so far become blobs of postgres store in place, lo/<oid>.
+-- When fs or s3 store is configured, server moves them there on startup
+
+BEGIN;
+
+ALTER TABLE docs.meta DISABLE TRIGGER updated_at_docs_trgr;
+
+-- blobs of postgres blob store
+CREATE TABLE IF NOT EXISTS docs.large_objects
+(
+	key                varchar(256) UNIQUE NOT NULL,
+	oid                oid UNIQUE NOT NULL,
+	size               bigint NOT NULL,
+	created_at         timestamptz NOT NULL DEFAULT NOW(),
+	PRIMARY KEY(key)
+);
+
+ALTER TABLE docs.meta ADD COLUMN blob varchar(256) UNIQUE DEFAULT NULL; -- blob store key
+ALTER TABLE docs.versions ADD COLUMN blob varchar(256) UNIQUE DEFAULT NULL; -- blob store key
+ALTER TABLE docs.uploads ADD COLUMN chunks text[] NOT NULL DEFAULT '{}'; -- blob keys of received chunks, in order
+
+INSERT INTO docs.large_objects(key, oid, size)
+	SELECT 'lo/' || oid, oid, size FROM docs.meta WHERE oid IS NOT NULL
+	UNION ALL
+	SELECT 'lo/' || oid, oid, size FROM docs.versions WHERE oid IS NOT NULL
+	UNION ALL
+	SELECT 'lo/' || oid, oid, "offset" FROM docs.uploads WHERE "offset" > 0;
+
+UPDATE docs.meta SET blob = 'lo/' || oid WHERE oid IS NOT NULL;
+UPDATE docs.versions SET blob = 'lo/' || oid WHERE oid IS NOT NULL;
+UPDATE docs.uploads SET chunks = ARRAY['lo/' || oid] WHERE "offset" > 0;
+
+-- uploads with nothing received leave no blob behind
+SELECT lo_unlink(oid) FROM docs.uploads WHERE "offset" = 0;
+
+ALTER TABLE docs.meta DROP CONSTRAINT file_oid_check;
+ALTER TABLE docs.meta ADD CONSTRAINT file_blob_check CHECK (
+	CASE
+		WHEN file = true THEN blob IS NOT NULL
+		ELSE TRUE
+	END
+);
+
+ALTER TABLE docs.meta DROP COLUMN oid;
+ALTER TABLE docs.versions DROP COLUMN oid;
+ALTER TABLE docs.uploads DROP COLUMN oid;
+
+ALTER TABLE docs.meta ENABLE TRIGGER updated_at_docs_trgr;
+
+GRANT INSERT, UPDATE, DELETE, SELECT ON docs.large_objects TO doc_server_admin;
+
+COMMIT;
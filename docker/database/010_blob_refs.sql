@@ -0,0 +1,74 @@
+\c doc_server
+
+-- identical file contents share one blob, docs.blobs counts references.
+-- Blobs kept so far are hashed, duplicates are folded into one of them.
+-- Ones too large to hash here keep no digest and are never shared
+
+BEGIN;
+
+ALTER TABLE docs.meta DISABLE TRIGGER updated_at_docs_trgr;
+
+-- file contents shared by documents and versions, refs counts
+-- meta and versions rows pointing to a blob
+CREATE TABLE IF NOT EXISTS docs.blobs
+(
+	key                varchar(256) UNIQUE NOT NULL, -- blob store key
+	sha256             char(64) UNIQUE DEFAULT NULL, -- null for blobs kept before digests, too large to hash
+	size               bigint NOT NULL,
+	refs               int NOT NULL DEFAULT 1,
+	created_at         timestamptz NOT NULL DEFAULT NOW(),
+	PRIMARY KEY(key)
+);
+
+ALTER TABLE docs.meta DROP CONSTRAINT meta_blob_key;
+ALTER TABLE docs.versions DROP CONSTRAINT versions_blob_key;
+
+ALTER TABLE docs.meta ADD COLUMN sha256 char(64) DEFAULT NULL; -- hex digest of file content
+ALTER TABLE docs.versions ADD COLUMN sha256 char(64) DEFAULT NULL; -- hex digest of file content
+
+-- blobs of other stores are counted too, content of them is out of reach here
+CREATE TEMPORARY TABLE blob_digests ON COMMIT DROP AS
+	SELECT r.key, lo.oid, r.size, CASE
+		WHEN lo.oid IS NOT NULL AND r.size <= 268435456 /* 256 MB */ THEN encode(sha256(lo_get(lo.oid)), 'hex')
+		ELSE NULL
+	END AS sha256
+	FROM (
+		SELECT blob AS key, max(size) AS size FROM (
+			SELECT blob, size FROM docs.meta UNION ALL SELECT blob, size FROM docs.versions
+		) AS b WHERE blob IS NOT NULL GROUP BY blob
+	) AS r
+	LEFT JOIN docs.large_objects lo ON lo.key = r.key;
+
+-- first key of each content is kept, unhashed keys keep themselves
+CREATE TEMPORARY TABLE blob_keys ON COMMIT DROP AS
+	SELECT d.key, CASE
+		WHEN d.sha256 IS NULL THEN d.key
+		ELSE first_value(d.key) OVER (PARTITION BY d.sha256 ORDER BY d.key)
+	END AS kept
+	FROM blob_digests d;
+
+UPDATE docs.meta m SET blob = k.kept, sha256 = d.sha256
+	FROM blob_keys k JOIN blob_digests d ON d.key = k.key
+	WHERE m.blob = k.key;
+
+UPDATE docs.versions v SET blob = k.kept, sha256 = d.sha256
+	FROM blob_keys k JOIN blob_digests d ON d.key = k.key
+	WHERE v.blob = k.key;
+
+INSERT INTO docs.blobs(key, sha256, size, refs)
+	SELECT d.key, d.sha256, d.size,
+		(SELECT count(*) FROM docs.meta WHERE blob = d.key) + (SELECT count(*) FROM docs.versions WHERE blob = d.key)
+	FROM blob_digests d JOIN blob_keys k ON k.key = d.key
+	WHERE k.kept = k.key;
+
+SELECT lo_unlink(d.oid) FROM blob_digests d JOIN blob_keys k ON k.key = d.key WHERE k.kept <> k.key AND d.oid IS NOT NULL;
+DELETE FROM docs.large_objects WHERE key IN (SELECT key FROM blob_keys WHERE kept <> key);
+
+CREATE INDEX IF NOT EXISTS meta_blob_idx ON docs.meta(blob);
+CREATE INDEX IF NOT EXISTS versions_blob_idx ON docs.versions(blob);
+
+ALTER TABLE docs.meta ENABLE TRIGGER updated_at_docs_trgr;
+
+GRANT INSERT, UPDATE, DELETE, SELECT ON docs.blobs TO doc_server_admin;
+
+COMMIT;
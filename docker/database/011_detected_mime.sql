@@ -0,0 +1,11 @@
+\c doc_server
+
+-- types sniffed from file content. Files kept so far were never
+-- sniffed, declared type is served for them until content is replaced
+
+BEGIN;
+
+ALTER TABLE docs.meta ADD COLUMN detected_mime varchar(256) DEFAULT NULL; -- sniffed from file content, served as content type
+ALTER TABLE docs.versions ADD COLUMN detected_mime varchar(256) DEFAULT NULL;
+
+COMMIT;
@@ -0,0 +1,45 @@
+\c doc_server
+
+-- full-text search over names and content text. Json documents kept so far
+-- are searchable by keys and string values at once, files by name only
+-- until content is replaced
+
+BEGIN;
+
+ALTER TABLE docs.meta DISABLE TRIGGER updated_at_docs_trgr;
+
+ALTER TABLE docs.meta ADD COLUMN content_text text DEFAULT NULL; -- searchable text of json or text file, head of it
+ALTER TABLE docs.versions ADD COLUMN content_text text DEFAULT NULL;
+
+ALTER TABLE docs.meta ADD COLUMN search tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('simple', name), 'A') || setweight(to_tsvector('simple', COALESCE(content_text, '')), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS meta_search_idx ON docs.meta USING GIN(search);
+
+-- documents failing to parse are left unsearchable by content
+DO $$
+DECLARE
+	doc record;
+	content jsonb;
+BEGIN
+	FOR doc IN SELECT id, json FROM docs.meta WHERE file = false AND json IS NOT NULL LOOP
+		BEGIN
+			content := convert_from(doc.json, 'UTF8')::jsonb;
+			UPDATE docs.meta SET content_text = (
+				SELECT left(string_agg(word, E'\n'), 131072) FROM (
+					SELECT jsonb_path_query(content, 'strict $.** ? (@.type() == "object").keyvalue().key') #>> '{}' AS word
+					UNION ALL
+					SELECT jsonb_path_query(content, 'strict $.** ? (@.type() == "string")') #>> '{}'
+				) AS words
+			) WHERE id = doc.id;
+		EXCEPTION WHEN others THEN
+			RAISE NOTICE 'document % is not searchable: %', doc.id, SQLERRM;
+		END;
+	END LOOP;
+END
+$$;
+
+ALTER TABLE docs.meta ENABLE TRIGGER updated_at_docs_trgr;
+
+COMMIT;
@@ -0,0 +1,13 @@
+\c doc_server
+
+-- json documents are kept as jsonb to be filtered by containment and jsonpath.
+-- Content is converted in place, it was validated as json when saved
+
+BEGIN;
+
+ALTER TABLE docs.meta ALTER COLUMN json TYPE jsonb USING convert_from(json, 'UTF8')::jsonb;
+ALTER TABLE docs.versions ALTER COLUMN json TYPE jsonb USING convert_from(json, 'UTF8')::jsonb;
+
+CREATE INDEX IF NOT EXISTS meta_json_idx ON docs.meta USING GIN(json jsonb_path_ops);
+
+COMMIT;
@@ -0,0 +1,29 @@
+\c doc_server
+
+-- json schemas owners validate json documents with, draft 2020-12.
+-- Documents kept so far name no schema, owner default applies on next save
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS docs.schemas
+(
+	owner_login        varchar(256) NOT NULL,
+	name               varchar(256) NOT NULL,
+	schema             jsonb NOT NULL,
+	is_default         bool NOT NULL DEFAULT false, -- applies to owner json documents naming no schema
+	created_at         timestamptz NOT NULL DEFAULT NOW(),
+	updated_at         timestamptz NOT NULL DEFAULT NOW(),
+	PRIMARY KEY(owner_login, name)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS schemas_default_idx ON docs.schemas(owner_login) WHERE is_default;
+
+CREATE TRIGGER created_at_schemas_trgr BEFORE UPDATE ON docs.schemas FOR EACH ROW EXECUTE PROCEDURE created_at_trigger();
+CREATE TRIGGER updated_at_schemas_trgr BEFORE UPDATE ON docs.schemas FOR EACH ROW EXECUTE PROCEDURE updated_at_trigger();
+
+ALTER TABLE docs.meta ADD COLUMN schema_name varchar(256) DEFAULT NULL; -- owner schema json is validated with, owner default if null
+ALTER TABLE docs.meta ADD FOREIGN KEY(owner_login, schema_name) REFERENCES docs.schemas(owner_login, name);
+
+GRANT INSERT, UPDATE, DELETE, SELECT ON docs.schemas TO doc_server_admin;
+
+COMMIT;
@@ -0,0 +1,35 @@
+\c doc_server
+
+-- folders owners organize documents in.
+-- Documents kept so far stay at root
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS docs.folders
+(
+	id                 varchar(256) UNIQUE NOT NULL,
+	owner_login        varchar(256) NOT NULL,
+	parent_id          varchar(256) DEFAULT NULL REFERENCES docs.folders(id),
+	name               varchar(256) NOT NULL,
+	path               text NOT NULL, -- /parent/name
+	grant_logins       jsonb NOT NULL DEFAULT '[]', -- granted on folder, inherited by everything inside
+	folder_grants      jsonb NOT NULL DEFAULT '[]', -- inherited from folders above
+	created_at         timestamptz NOT NULL DEFAULT NOW(),
+	updated_at         timestamptz NOT NULL DEFAULT NOW(),
+	PRIMARY KEY(id),
+	UNIQUE(owner_login, path)
+);
+
+CREATE INDEX IF NOT EXISTS folders_parent_id_idx ON docs.folders(parent_id);
+
+CREATE TRIGGER created_at_folders_trgr BEFORE UPDATE ON docs.folders FOR EACH ROW EXECUTE PROCEDURE created_at_trigger();
+CREATE TRIGGER updated_at_folders_trgr BEFORE UPDATE ON docs.folders FOR EACH ROW EXECUTE PROCEDURE updated_at_trigger();
+
+ALTER TABLE docs.meta ADD COLUMN parent_id varchar(256) DEFAULT NULL REFERENCES docs.folders(id); -- folder, root if null
+ALTER TABLE docs.meta ADD COLUMN folder_grants jsonb NOT NULL DEFAULT '[]'; -- grants of folders above, kept in sync with them
+
+CREATE INDEX IF NOT EXISTS meta_parent_id_idx ON docs.meta(parent_id);
+
+GRANT INSERT, UPDATE, DELETE, SELECT ON docs.folders TO doc_server_admin;
+
+COMMIT;
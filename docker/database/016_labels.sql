@@ -0,0 +1,14 @@
+\c doc_server
+
+-- tags and user defined key values of documents,
+-- documents kept so far have none
+
+BEGIN;
+
+ALTER TABLE docs.meta ADD COLUMN tags jsonb NOT NULL DEFAULT '[]'; -- ["tag", ...]
+ALTER TABLE docs.meta ADD COLUMN metadata jsonb NOT NULL DEFAULT '{}'; -- {"key": "value", ...}, user defined
+
+CREATE INDEX IF NOT EXISTS meta_tags_idx ON docs.meta USING GIN(tags jsonb_path_ops);
+CREATE INDEX IF NOT EXISTS meta_metadata_idx ON docs.meta USING GIN(metadata jsonb_path_ops);
+
+COMMIT;
@@ -0,0 +1,11 @@
+\c doc_server
+
+-- deleted documents stay in trash until purged
+
+BEGIN;
+
+ALTER TABLE docs.meta ADD COLUMN deleted_at timestamptz DEFAULT NULL; -- in trash since, purged after DOCS_TRASH_TTL
+
+CREATE INDEX IF NOT EXISTS meta_deleted_at_idx ON docs.meta(deleted_at) WHERE deleted_at IS NOT NULL;
+
+COMMIT;
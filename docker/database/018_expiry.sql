@@ -0,0 +1,11 @@
+\c doc_server
+
+-- documents may expire, the reaper removes them
+
+BEGIN;
+
+ALTER TABLE docs.meta ADD COLUMN expires_at timestamptz DEFAULT NULL; -- removed after, gone for readers at once
+
+CREATE INDEX IF NOT EXISTS meta_expires_at_idx ON docs.meta(expires_at) WHERE expires_at IS NOT NULL;
+
+COMMIT;
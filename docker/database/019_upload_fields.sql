@@ -0,0 +1,13 @@
+\c doc_server
+
+-- uploads carry folder, tags, metadata and expiry of the document they become.
+-- Pending uploads go to root with none of them
+
+BEGIN;
+
+ALTER TABLE docs.uploads ADD COLUMN parent_id varchar(256) DEFAULT NULL REFERENCES docs.folders(id); -- folder, root if null
+ALTER TABLE docs.uploads ADD COLUMN tags jsonb NOT NULL DEFAULT '[]';
+ALTER TABLE docs.uploads ADD COLUMN metadata jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE docs.uploads ADD COLUMN doc_expires_at timestamptz DEFAULT NULL; -- document expires_at
+
+COMMIT;
@@ -0,0 +1,36 @@
+package blob
+
+import (
+	"io"
+	"fmt"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/bd878/doc_server/config"
+)
+
+var ErrNoBlob = errors.New("no blob")
+
+// Store keeps file contents under keys chosen by callers.
+// Failed Put leaves nothing stored
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader) (size int64, err error)
+	Get(ctx context.Context, key string, w io.Writer) (err error)
+	Range(ctx context.Context, key string, offset, length int64, w io.Writer) (err error)
+	Delete(ctx context.Context, key string) (err error)
+	Stat(ctx context.Context, key string) (size int64, err error)
+}
+
+// New creates store configured by cfg.Store: postgres, fs or s3
+func New(cfg config.BlobConfig, pool *pgxpool.Pool) (Store, error) {
+	switch cfg.Store {
+	case "postgres":
+		return NewLargeObjects("docs.large_objects", pool), nil
+	case "fs":
+		return NewFS(cfg.Dir)
+	case "s3":
+		return NewS3(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3Timeout, cfg.S3RequestTimeout)
+	default:
+		return nil, fmt.Errorf("unknown blob store %q", cfg.Store)
+	}
+}
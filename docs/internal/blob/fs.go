@@ -0,0 +1,127 @@
+package blob
+
+import (
+	"io"
+	"os"
+	"context"
+	"errors"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+)
+
+// FS keeps blobs as files under dir, sharded by key hash
+// into two levels of directories so none grows too large
+type FS struct {
+	dir  string
+}
+
+func NewFS(dir string) (*FS, error) {
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FS{dir: dir}, nil
+}
+
+// Put writes to a temporary file renamed in place once complete,
+// so readers never see partial content
+func (s *FS) Put(ctx context.Context, key string, r io.Reader) (size int64, err error) {
+	path := s.path(key)
+
+	err = os.MkdirAll(filepath.Dir(path), 0o750)
+	if err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".put-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	size, err = io.Copy(tmp, r)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		return 0, err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return 0, err
+	}
+
+	return
+}
+
+func (s *FS) Get(ctx context.Context, key string, w io.Writer) (err error) {
+	f, err := s.open(key)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return
+}
+
+func (s *FS) Range(ctx context.Context, key string, offset, length int64, w io.Writer) (err error) {
+	f, err := s.open(key)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, io.NewSectionReader(f, offset, length))
+	return
+}
+
+func (s *FS) Delete(ctx context.Context, key string) (err error) {
+	err = os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNoBlob
+	}
+	return
+}
+
+func (s *FS) Stat(ctx context.Context, key string) (size int64, err error) {
+	info, err := os.Stat(s.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, ErrNoBlob
+		}
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+func (s *FS) open(key string) (*os.File, error) {
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoBlob
+	}
+	return f, err
+}
+
+// path hashes key, so any key makes a safe file name
+func (s *FS) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(s.dir, name[0:2], name[2:4], name)
+}
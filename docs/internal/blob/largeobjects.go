@@ -0,0 +1,168 @@
+package blob
+
+import (
+	"io"
+	"fmt"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LargeObjects keeps blobs in postgres large objects,
+// tableName maps keys to object ids
+type LargeObjects struct {
+	tableName  string
+	pool      *pgxpool.Pool
+}
+
+func NewLargeObjects(tableName string, pool *pgxpool.Pool) *LargeObjects {
+	return &LargeObjects{
+		tableName:  tableName,
+		pool:       pool,
+	}
+}
+
+func (s *LargeObjects) Put(ctx context.Context, key string, r io.Reader) (size int64, err error) {
+	const query = "INSERT INTO %s(key, oid, size) VALUES ($1, $2, $3)"
+
+	err = s.inTx(ctx, func(tx pgx.Tx) error {
+		lb := tx.LargeObjects()
+		oid, err := lb.Create(ctx, 0)
+		if err != nil {
+			return err
+		}
+
+		object, err := lb.Open(ctx, oid, pgx.LargeObjectModeWrite)
+		if err != nil {
+			return err
+		}
+		defer object.Close()
+
+		size, err = io.Copy(object, r)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, s.table(query), key, oid, size)
+		return err
+	})
+
+	return
+}
+
+func (s *LargeObjects) Get(ctx context.Context, key string, w io.Writer) (err error) {
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		object, err := s.open(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		defer object.Close()
+
+		_, err = io.Copy(w, object)
+		return err
+	})
+}
+
+// Range seeks inside the object instead of reading from the beginning
+func (s *LargeObjects) Range(ctx context.Context, key string, offset, length int64, w io.Writer) (err error) {
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		object, err := s.open(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		defer object.Close()
+
+		_, err = object.Seek(offset, io.SeekStart)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.CopyN(w, object, length)
+		return err
+	})
+}
+
+func (s *LargeObjects) Delete(ctx context.Context, key string) (err error) {
+	const query = "DELETE FROM %s WHERE key = $1 RETURNING oid"
+
+	return s.inTx(ctx, func(tx pgx.Tx) error {
+		var oid uint32
+		err := tx.QueryRow(ctx, s.table(query), key).Scan(&oid)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrNoBlob
+			}
+			return err
+		}
+
+		lb := tx.LargeObjects()
+		return lb.Unlink(ctx, oid)
+	})
+}
+
+func (s *LargeObjects) Stat(ctx context.Context, key string) (size int64, err error) {
+	const query = "SELECT size FROM %s WHERE key = $1"
+
+	err = s.pool.QueryRow(ctx, s.table(query), key).Scan(&size)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = ErrNoBlob
+	}
+
+	return
+}
+
+// keys lists up to limit keys kept
+func (s *LargeObjects) keys(ctx context.Context, limit int) (keys []string, err error) {
+	const query = "SELECT key FROM %s ORDER BY key LIMIT $1"
+
+	rows, err := s.pool.Query(ctx, s.table(query), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func (s *LargeObjects) open(ctx context.Context, tx pgx.Tx, key string) (*pgx.LargeObject, error) {
+	const query = "SELECT oid FROM %s WHERE key = $1"
+
+	var oid uint32
+	err := tx.QueryRow(ctx, s.table(query), key).Scan(&oid)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoBlob
+		}
+		return nil, err
+	}
+
+	lb := tx.LargeObjects()
+	return lb.Open(ctx, oid, pgx.LargeObjectModeRead)
+}
+
+// inTx runs fn in transaction, large objects are usable only inside one
+func (s *LargeObjects) inTx(ctx context.Context, fn func(tx pgx.Tx) error) (err error) {
+	var tx pgx.Tx
+	tx, err = s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		p := recover()
+		switch {
+		case p != nil:
+			_ = tx.Rollback(ctx)
+			panic(p)
+		case err != nil:
+			_ = tx.Rollback(ctx)
+		default:
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	return fn(tx)
+}
+
+func (s LargeObjects) table(query string) string {
+	return fmt.Sprintf(query, s.tableName)
+}
@@ -0,0 +1,44 @@
+package blob
+
+import (
+	"io"
+	"context"
+)
+
+// moveBatch is how many keys are listed at once while moving
+const moveBatch = 100
+
+// Move moves blobs of from into to under the same keys. Content kept in
+// large objects before another store was configured is moved so, blobs
+// are deleted from large objects once copied and moving again resumes
+func Move(ctx context.Context, from *LargeObjects, to Store) (count int, err error) {
+	for {
+		var keys []string
+		keys, err = from.keys(ctx, moveBatch)
+		if err != nil {
+			return
+		}
+		if len(keys) == 0 {
+			return
+		}
+
+		for _, key := range keys {
+			pr, pw := io.Pipe()
+			go func() {
+				pw.CloseWithError(from.Get(ctx, key, pw))
+			}()
+
+			_, err = to.Put(ctx, key, pr)
+			pr.CloseWithError(err)
+			if err != nil {
+				return
+			}
+
+			err = from.Delete(ctx, key)
+			if err != nil {
+				return
+			}
+			count++
+		}
+	}
+}
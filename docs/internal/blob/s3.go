@@ -0,0 +1,356 @@
+package blob
+
+import (
+	"io"
+	"fmt"
+	"sort"
+	"time"
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"net"
+	"net/url"
+	"net/http"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+)
+
+// s3PartSize is how much of a blob is buffered per request,
+// larger blobs go as multipart uploads. S3 needs parts of 5 MB at least
+const s3PartSize = 8 << 20 /* 8 MB */
+
+// S3 keeps blobs in a bucket of S3 compatible storage,
+// objects are addressed path style, endpoint/bucket/key
+type S3 struct {
+	endpoint   *url.URL
+	region     string
+	bucket     string
+	accessKey  string
+	secretKey  string
+	client     *http.Client
+}
+
+// NewS3 creates store, timeout bounds connecting and waiting for
+// response headers, requestTimeout bounds whole request with its body
+func NewS3(endpoint, region, bucket, accessKey, secretKey string, timeout, requestTimeout time.Duration) (*S3, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Host == "" || bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket required")
+	}
+
+	return &S3{
+		endpoint:   u,
+		region:     region,
+		bucket:     bucket,
+		accessKey:  accessKey,
+		secretKey:  secretKey,
+		client:     &http.Client{
+			Timeout:    requestTimeout,
+			Transport:  &http.Transport{
+				Proxy:                  http.ProxyFromEnvironment,
+				DialContext:            (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext,
+				TLSHandshakeTimeout:    timeout,
+				ResponseHeaderTimeout:  timeout,
+				ExpectContinueTimeout:  time.Second,
+				MaxIdleConns:           100,
+				MaxIdleConnsPerHost:    16,
+				IdleConnTimeout:        90 * time.Second,
+			},
+		},
+	}, nil
+}
+
+// Put sends blobs smaller than a part in one request,
+// others are streamed part by part
+func (s *S3) Put(ctx context.Context, key string, r io.Reader) (size int64, err error) {
+	buf := make([]byte, s3PartSize)
+
+	n, err := io.ReadFull(r, buf)
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF:
+		resp, err := s.do(ctx, http.MethodPut, key, nil, nil, buf[:n])
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+
+		return int64(n), nil
+	case nil:
+		return s.putMultipart(ctx, key, buf, r)
+	default:
+		return 0, err
+	}
+}
+
+type s3Part struct {
+	Number  int     `xml:"PartNumber"`
+	ETag    string  `xml:"ETag"`
+}
+
+// putMultipart uploads buf, which is a full part, followed by the rest of r
+func (s *S3) putMultipart(ctx context.Context, key string, buf []byte, r io.Reader) (size int64, err error) {
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var initiated struct {
+		UploadID  string  `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	uploadID := url.Values{"uploadId": {initiated.UploadID}}
+	defer func() {
+		if err != nil {
+			resp, err := s.do(context.WithoutCancel(ctx), http.MethodDelete, key, uploadID, nil, nil)
+			if err == nil {
+				resp.Body.Close()
+			}
+		}
+	}()
+
+	var parts []s3Part
+	part := buf
+	for number := 1; len(part) > 0; number++ {
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": uploadID["uploadId"]}
+
+		resp, err := s.do(ctx, http.MethodPut, key, query, nil, part)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+
+		parts = append(parts, s3Part{Number: number, ETag: resp.Header.Get("ETag")})
+		size += int64(len(part))
+
+		if len(part) < len(buf) {
+			break
+		}
+
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		part = buf[:n]
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName  xml.Name  `xml:"CompleteMultipartUpload"`
+		Parts    []s3Part  `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err = s.do(ctx, http.MethodPost, key, uploadID, nil, body)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// completion may fail after 200 is sent, error is in the body then
+	var result struct {
+		XMLName  xml.Name
+		Message  string  `xml:"Message"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return 0, err
+	}
+	if result.XMLName.Local == "Error" {
+		return 0, fmt.Errorf("s3 complete %s: %s", key, result.Message)
+	}
+
+	return
+}
+
+func (s *S3) Get(ctx context.Context, key string, w io.Writer) (err error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	return
+}
+
+func (s *S3) Range(ctx context.Context, key string, offset, length int64, w io.Writer) (err error) {
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)}}
+
+	resp, err := s.do(ctx, http.MethodGet, key, nil, header, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.CopyN(w, resp.Body, length)
+	return
+}
+
+func (s *S3) Delete(ctx context.Context, key string) (err error) {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (size int64, err error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	return resp.ContentLength, nil
+}
+
+// do sends signed request, responses other than 2xx are errors
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + "/" + key
+	u.RawPath = s3Escape(u.Path, false)
+	u.RawQuery = s3Query(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.ContentLength = int64(len(body))
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	sum := sha256.Sum256(body)
+	s.sign(req, hex.EncodeToString(sum[:]), time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNoBlob
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("s3 %s %s: %s %s", method, key, resp.Status, message)
+	}
+
+	return resp, nil
+}
+
+// sign adds AWS signature version 4 authorization,
+// host, range and x-amz-* headers are signed
+func (s *S3) sign(req *http.Request, payloadHash string, now time.Time) {
+	date := now.Format("20060102")
+	amzDate := now.Format("20060102T150405Z")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Query encodes query sorted by key as signature requires
+func s3Query(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, s3Escape(key, true) + "=" + s3Escape(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape percent-encodes all but unreserved characters,
+// slashes are kept in paths
+func s3Escape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
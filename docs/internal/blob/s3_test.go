@@ -0,0 +1,306 @@
+package blob
+
+import (
+	"io"
+	"fmt"
+	"sync"
+	"time"
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"net/http"
+	"encoding/xml"
+	"net/http/httptest"
+)
+
+// fakeS3 keeps objects of one bucket in memory,
+// multipart parts are joined on completion
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	parts    map[string]map[int][]byte
+	aborted  int
+	uploads  int
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *S3) {
+	t.Helper()
+
+	fake := &fakeS3{objects: make(map[string][]byte), parts: make(map[string]map[int][]byte)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	s, err := NewS3(server.URL, "us-east-1", "bucket", "access", "secret", time.Second, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fake, s
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+		http.Error(w, "unsigned", http.StatusForbidden)
+		return
+	}
+
+	key, ok := strings.CutPrefix(req.URL.Path, "/bucket/")
+	if !ok {
+		http.Error(w, "no bucket", http.StatusNotFound)
+		return
+	}
+
+	query := req.URL.Query()
+	uploadID := query.Get("uploadId")
+
+	switch {
+	case req.Method == http.MethodPost && query.Has("uploads"):
+		f.uploads++
+		uploadID = strconv.Itoa(f.uploads)
+		f.parts[uploadID] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+
+	case req.Method == http.MethodPut && uploadID != "":
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		body, _ := io.ReadAll(req.Body)
+		f.parts[uploadID][number] = body
+		w.Header().Set("ETag", fmt.Sprintf("\"%d\"", number))
+
+	case req.Method == http.MethodPost && uploadID != "":
+		var complete struct {
+			Parts  []s3Part  `xml:"Part"`
+		}
+		xml.NewDecoder(req.Body).Decode(&complete)
+
+		var object []byte
+		for _, part := range complete.Parts {
+			object = append(object, f.parts[uploadID][part.Number]...)
+		}
+		f.objects[key] = object
+		delete(f.parts, uploadID)
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+
+	case req.Method == http.MethodDelete && uploadID != "":
+		f.aborted++
+		delete(f.parts, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+
+	case req.Method == http.MethodPut:
+		body, _ := io.ReadAll(req.Body)
+		if int64(len(body)) != req.ContentLength {
+			http.Error(w, "short body", http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = body
+
+	case req.Method == http.MethodGet, req.Method == http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, req, key, time.Time{}, bytes.NewReader(object))
+
+	case req.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "unexpected", http.StatusMethodNotAllowed)
+	}
+}
+
+func testContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	return content
+}
+
+func TestS3Put(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		multipart  bool
+	}{
+		{"empty", 0, false},
+		{"small", 1024, false},
+		{"one byte short of part", s3PartSize - 1, false},
+		{"exactly one part", s3PartSize, true},
+		{"several parts", 2*s3PartSize + 17, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake, s := newFakeS3(t)
+			content := testContent(test.size)
+
+			size, err := s.Put(context.Background(), "docs/a b", bytes.NewReader(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != int64(test.size) {
+				t.Errorf("size %d, want %d", size, test.size)
+			}
+			if !bytes.Equal(fake.objects["docs/a b"], content) {
+				t.Errorf("stored %d bytes differ from content", len(fake.objects["docs/a b"]))
+			}
+			if (fake.uploads > 0) != test.multipart {
+				t.Errorf("multipart uploads %d, want multipart %v", fake.uploads, test.multipart)
+			}
+		})
+	}
+}
+
+type failingReader struct {
+	r  io.Reader
+}
+
+func (f failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("broken")
+	}
+	return n, err
+}
+
+func TestS3PutAbortsMultipart(t *testing.T) {
+	fake, s := newFakeS3(t)
+
+	_, err := s.Put(context.Background(), "key", failingReader{bytes.NewReader(testContent(s3PartSize + 1))})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if fake.aborted != 1 || len(fake.parts) != 0 {
+		t.Errorf("aborted %d, pending %d, want upload aborted", fake.aborted, len(fake.parts))
+	}
+	if _, ok := fake.objects["key"]; ok {
+		t.Error("failed put left object")
+	}
+}
+
+func TestS3Get(t *testing.T) {
+	_, s := newFakeS3(t)
+	content := testContent(4096)
+
+	_, err := s.Put(context.Background(), "key", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = s.Get(context.Background(), "key", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), content) {
+		t.Error("got content differs")
+	}
+}
+
+func TestS3Range(t *testing.T) {
+	_, s := newFakeS3(t)
+	content := testContent(4096)
+
+	_, err := s.Put(context.Background(), "key", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		offset  int64
+		length  int64
+	}{
+		{0, 1},
+		{0, 4096},
+		{100, 200},
+		{4095, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d-%d", test.offset, test.length), func(t *testing.T) {
+			var buf bytes.Buffer
+			err := s.Range(context.Background(), "key", test.offset, test.length, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), content[test.offset:test.offset+test.length]) {
+				t.Errorf("range %d bytes differ", buf.Len())
+			}
+		})
+	}
+}
+
+func TestS3StatDelete(t *testing.T) {
+	_, s := newFakeS3(t)
+
+	_, err := s.Put(context.Background(), "key", bytes.NewReader(testContent(123)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := s.Stat(context.Background(), "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 123 {
+		t.Errorf("stat size %d, want 123", size)
+	}
+
+	err = s.Delete(context.Background(), "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Stat(context.Background(), "key")
+	if !errors.Is(err, ErrNoBlob) {
+		t.Errorf("stat after delete: %v, want ErrNoBlob", err)
+	}
+}
+
+func TestS3NoBlob(t *testing.T) {
+	_, s := newFakeS3(t)
+
+	tests := []struct {
+		name  string
+		call  func() error
+	}{
+		{"get", func() error { return s.Get(context.Background(), "missing", io.Discard) }},
+		{"range", func() error { return s.Range(context.Background(), "missing", 0, 1, io.Discard) }},
+		{"stat", func() error { _, err := s.Stat(context.Background(), "missing"); return err }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.call()
+			if !errors.Is(err, ErrNoBlob) {
+				t.Errorf("got %v, want ErrNoBlob", err)
+			}
+		})
+	}
+}
+
+func TestS3Query(t *testing.T) {
+	tests := []struct {
+		query  map[string][]string
+		want   string
+	}{
+		{nil, ""},
+		{map[string][]string{"uploads": {""}}, "uploads="},
+		{map[string][]string{"uploadId": {"a/b+c"}, "partNumber": {"2"}}, "partNumber=2&uploadId=a%2Fb%2Bc"},
+	}
+
+	for _, test := range tests {
+		got := s3Query(test.query)
+		if got != test.want {
+			t.Errorf("s3Query(%v) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
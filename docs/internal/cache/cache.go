@@ -14,22 +14,6 @@ type Cache struct {
 	loginToMeta    map[string][]*docs.Meta
 }
 
-type TsSorted []*docs.Meta
-
-var _ sort.Interface  = (*TsSorted)(nil)
-
-func (t TsSorted) Len() int {
-	return len(t)
-}
-
-func (t TsSorted) Less(i, j int) bool {
-	return t[i].Ts < t[j].Ts
-}
-
-func (t TsSorted) Swap(i, j int) {
-	t[i], t[j] = t[j], t[i]
-}
-
 func New(log zerolog.Logger) *Cache {
 	return &Cache{
 		log:          log,
@@ -59,14 +43,26 @@ func (c *Cache) Set(owner string, meta *docs.Meta) {
 		c.loginToMeta[login] = metas
 	}
 
-	logins = append(logins, owner)
-	addToLogin(owner)
-	for _, login := range meta.Grant {
-		logins = append(logins, login)
+	// login granted both by document and by folder is indexed once
+	seen := make(map[string]bool, 0)
+	index := func(login string) {
+		if seen[login] {
+			return
+		}
+		seen[login] = true
 
+		logins = append(logins, login)
 		addToLogin(login)
 	}
 
+	index(owner)
+	for _, grant := range meta.Grant {
+		index(grant.Login)
+	}
+	for _, grant := range meta.Inherited {
+		index(grant.Login)
+	}
+
 	c.idToLogin[meta.ID] = logins
 }
 
@@ -78,7 +74,7 @@ func (c *Cache) Get(id, login string) (meta *docs.Meta) {
 
 	for _, metas := range c.loginToMeta {
 		for _, meta := range metas {
-			if meta.ID == id {
+			if meta.ID == id && meta.Allowed(login, docs.PermissionRead) {
 				c.log.Log().Str("id", id).Msg("cache hit")
 				return meta
 			}
@@ -139,69 +135,40 @@ func (c *Cache) Remove(id string) {
 	delete(c.idToLogin, id)
 }
 
-func (c *Cache) List(owner, key string, value interface{}, limit int) (list []*docs.Meta) {
+// List lists documents shared with q.Login that are cached, matched
+// as repository does. Nil list means nothing is cached for login,
+// owned documents are always listed by repository
+func (c *Cache) List(q *docs.ListQuery) (list []*docs.Meta, next string) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	c.log.Log().Str("owner", owner).Str("key", key).Any("value", value).Int("limit", limit).Msg("cache list docs")
+	c.log.Log().Str("login", q.Login).Str("sort", q.Sort).Bool("desc", q.Desc).Int("limit", q.Limit).Msg("cache list docs")
 
-	list = make([]*docs.Meta, 0)
-	metas, ok := c.loginToMeta[owner]
+	if q.Login == "" {
+		return nil, ""
+	}
+
+	metas, ok := c.loginToMeta[q.Login]
 	if !ok {
-		return nil
+		return nil, ""
 	}
 
+	list = make([]*docs.Meta, 0)
 	for _, meta := range metas {
-		switch key {
-		case "name":
-			name, ok := value.(string)
-			if !ok {
-				return nil
-			}
-			if meta.Name == name {
-				list = append(list, meta)
-			}
-		case "file":
-			file, ok := value.(bool)
-			if !ok {
-				return nil
-			}
-			if meta.File == file {
-				list = append(list, meta)
-			}
-		case "mime":
-			mime, ok := value.(string)
-			if !ok {
-				return nil
-			}
-			if meta.Mime == mime {
-				list = append(list, meta)
-			}
-		case "public":
-			public, ok := value.(bool)
-			if !ok {
-				return nil
-			}
-			if meta.Public == public {
-				list = append(list, meta)
-			}
-		case "created":
-			created, ok := value.(string)
-			if !ok {
-				return nil
-			}
-			if meta.Created == created {
-				list = append(list, meta)
-			}
+		if q.Match(meta) && q.After(meta) {
+			list = append(list, meta)
 		}
 	}
 
 	c.log.Log().Int("len(list)", len(list)).Msg("docs found in cache")
 
-	sort.Sort(TsSorted(list))
+	sort.Slice(list, func(i, j int) bool {
+		return q.Less(list[i], list[j])
+	})
 
-	if len(list) > limit {
-		list = list[:limit]
+	if len(list) > q.Limit {
+		list = list[:q.Limit]
+		next = q.NextCursor(list[len(list)-1])
 	}
 
 	return
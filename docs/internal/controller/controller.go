@@ -3,40 +3,89 @@ package controller
 import (
 	"context"
 	"io"
-	"strconv"
-	"mime/multipart"
+	"time"
 	"encoding/json"
 	"github.com/google/uuid"
 	docs "github.com/bd878/doc_server/docs/pkg/model"
 )
 
 type Repository interface {
-	Save(ctx context.Context, owner string, f multipart.File, json []byte, meta *docs.Meta) (err error)
-	List(ctx context.Context, owner, login, key string, value interface{}, limit int) (docs []*docs.Meta, err error)
+	Save(ctx context.Context, owner string, f io.Reader, json []byte, meta *docs.Meta) (err error)
+	Update(ctx context.Context, login, id, ifMatch string, f io.Reader, json []byte, meta *docs.Meta) (err error)
+	UpdateMeta(ctx context.Context, login, id, ifMatch string, patch *docs.UpdateMeta) (meta *docs.Meta, err error)
+	Patch(ctx context.Context, login, id, ifMatch, kind string, patch []byte) (meta *docs.Meta, json []byte, err error)
+	SetGrant(ctx context.Context, login, id string, grant docs.Grant) (meta *docs.Meta, err error)
+	RevokeGrant(ctx context.Context, login, id, grantee string) (meta *docs.Meta, err error)
+	List(ctx context.Context, q *docs.ListQuery) (docs []*docs.Meta, next string, err error)
+	Summary(ctx context.Context, q *docs.ListQuery) (summary *docs.ListSummary, err error)
+	Search(ctx context.Context, login, text string, limit int) (results []*docs.SearchResult, err error)
+	ListPublic(ctx context.Context, owner string, limit int) (docs []*docs.Meta, err error)
 	GetMeta(ctx context.Context, id, login string) (meta *docs.Meta, err error)
-	ReadFile(ctx context.Context, oid uint32, writer io.Writer) (err error)
-	ReadJSON(ctx context.Context, id string) (json json.RawMessage, err error)
-	Delete(ctx context.Context, id string) (err error)
+	FindMeta(ctx context.Context, id string) (meta *docs.Meta, err error)
+	ListVersions(ctx context.Context, id string) (versions []*docs.Version, err error)
+	GetVersion(ctx context.Context, id string, n int) (version *docs.Version, json []byte, err error)
+	Restore(ctx context.Context, id string, n int) (meta *docs.Meta, err error)
+	ReadFile(ctx context.Context, key string, writer io.Writer) (err error)
+	ReadFileRange(ctx context.Context, key string, start, length int64, writer io.Writer) (err error)
+	ReadJSON(ctx context.Context, id, path string) (json json.RawMessage, err error)
+	Delete(ctx context.Context, login, id, ifMatch string) (err error)
+	SaveSchema(ctx context.Context, schema *docs.Schema) (err error)
+	ListSchemas(ctx context.Context, owner string) (schemas []*docs.Schema, err error)
+	GetSchema(ctx context.Context, owner, name string) (schema *docs.Schema, err error)
+	DeleteSchema(ctx context.Context, owner, name string) (err error)
+	CreateFolder(ctx context.Context, folder *docs.Folder) (err error)
+	GetFolder(ctx context.Context, id string) (folder *docs.Folder, err error)
+	ListFolders(ctx context.Context, owner, parentID string) (folders []*docs.Folder, err error)
+	UpdateFolder(ctx context.Context, login, id string, name, parentID *string) (folder *docs.Folder, changed []string, err error)
+	DeleteFolder(ctx context.Context, login, id string) (err error)
+	SetFolderGrant(ctx context.Context, login, id string, grant docs.Grant) (folder *docs.Folder, changed []string, err error)
+	RevokeFolderGrant(ctx context.Context, login, id, grantee string) (folder *docs.Folder, changed []string, err error)
+	ListTrash(ctx context.Context, login string) (docs []*docs.Meta, err error)
+	RestoreTrash(ctx context.Context, login, id string) (meta *docs.Meta, err error)
+	Purge(ctx context.Context, before time.Time, limit int) (ids []string, err error)
+	Reap(ctx context.Context, limit int) (ids []string, err error)
 }
 
 type Cache interface {
 	Set(owner string, meta *docs.Meta)
 	Get(id, login string) (meta *docs.Meta)
-	List(login, key string, value interface{}, limit int) (docs []*docs.Meta)
+	List(q *docs.ListQuery) (docs []*docs.Meta, next string)
 	Free(login string)
 	Remove(id string)
 }
 
+type LinksRepository interface {
+	Save(ctx context.Context, link *docs.Link, passwordHash []byte) (err error)
+	Get(ctx context.Context, id string) (link *docs.Link, passwordHash []byte, err error)
+	List(ctx context.Context, docID string) (links []*docs.Link, err error)
+	Use(ctx context.Context, id string) (err error)
+	Revoke(ctx context.Context, docID, id string) (err error)
+}
+
+type UploadsRepository interface {
+	Create(ctx context.Context, upload *docs.Upload) (meta *docs.Meta, err error)
+	Get(ctx context.Context, id, owner string) (upload *docs.Upload, err error)
+	Write(ctx context.Context, id, owner string, offset int64, chunk io.Reader) (upload *docs.Upload, meta *docs.Meta, err error)
+	Delete(ctx context.Context, id, owner string) (err error)
+	Expire(ctx context.Context) (count int, err error)
+}
+
 type Controller struct {
-	repo     Repository
-	cache    Cache
+	repo       Repository
+	links      LinksRepository
+	uploads    UploadsRepository
+	cache      Cache
+	secret     []byte
+	linkTTL    time.Duration
+	uploadTTL  time.Duration
+	trashTTL   time.Duration
 }
 
-func New(repo Repository, cache Cache) *Controller {
-	return &Controller{repo, cache}
+func New(repo Repository, links LinksRepository, uploads UploadsRepository, cache Cache, secret []byte, linkTTL, uploadTTL, trashTTL time.Duration) *Controller {
+	return &Controller{repo, links, uploads, cache, secret, linkTTL, uploadTTL, trashTTL}
 }
 
-func (c Controller) Save(ctx context.Context, owner string, f multipart.File, json []byte, meta *docs.Meta) (err error) {
+func (c Controller) Save(ctx context.Context, owner string, f io.Reader, json []byte, meta *docs.Meta) (err error) {
 	meta.ID = uuid.New().String()
 
 	err = c.repo.Save(ctx, owner, f, json, meta)
@@ -49,49 +98,151 @@ func (c Controller) Save(ctx context.Context, owner string, f multipart.File, js
 	return
 }
 
-func (c Controller) List(ctx context.Context, owner, login, key, value string, limit int) (docs []*docs.Meta, err error) {
-	var val interface{}
-	if key == "file" || key == "public" {
-		file, err := strconv.ParseBool(value)
-		if err != nil {
-			return nil, err
-		}
-		val = file
-	} else {
-		val = value
+func (c Controller) Update(ctx context.Context, login, id, ifMatch string, f io.Reader, json []byte, meta *docs.Meta) (err error) {
+	err = c.repo.Update(ctx, login, id, ifMatch, f, json, meta)
+	if err != nil {
+		return
+	}
+
+	c.cache.Remove(id)
+	c.cache.Set(meta.Owner, meta)
+
+	return
+}
+
+func (c Controller) UpdateMeta(ctx context.Context, login, id, ifMatch string, patch *docs.UpdateMeta) (meta *docs.Meta, err error) {
+	meta, err = c.repo.UpdateMeta(ctx, login, id, ifMatch, patch)
+	if err != nil {
+		return
+	}
+
+	c.recache(meta)
+
+	return
+}
+
+// Patch applies json patch or merge patch to json document
+func (c Controller) Patch(ctx context.Context, login, id, ifMatch, kind string, patch []byte) (meta *docs.Meta, json []byte, err error) {
+	meta, json, err = c.repo.Patch(ctx, login, id, ifMatch, kind, patch)
+	if err != nil {
+		return
+	}
+
+	c.recache(meta)
+
+	return
+}
+
+func (c Controller) SetGrant(ctx context.Context, login, id string, grant docs.Grant) (meta *docs.Meta, err error) {
+	meta, err = c.repo.SetGrant(ctx, login, id, grant)
+	if err != nil {
+		return
+	}
+
+	c.recache(meta)
+
+	return
+}
+
+func (c Controller) RevokeGrant(ctx context.Context, login, id, grantee string) (meta *docs.Meta, err error) {
+	meta, err = c.repo.RevokeGrant(ctx, login, id, grantee)
+	if err != nil {
+		return
 	}
 
-	if login != "" {
-		docs = c.cache.List(login, key, val, limit)
-	} else {
-		docs = c.cache.List(login, key, val, limit)
+	c.recache(meta)
+
+	return
+}
+
+// recache rebuilds login indexes of a document which grant list may have changed
+func (c Controller) recache(meta *docs.Meta) {
+	c.cache.Remove(meta.ID)
+	c.cache.Set(meta.Owner, meta)
+}
+
+func (c Controller) List(ctx context.Context, q *docs.ListQuery) (docs []*docs.Meta, next string, err error) {
+	if q.Cacheable() {
+		docs, next = c.cache.List(q)
 	}
 	if docs == nil {
-		return c.repo.List(ctx, owner, login, key, val, limit)
+		return c.repo.List(ctx, q)
 	}
 	return
 }
 
+// ListSummary counts all documents q matches, it is always
+// read from repository, cache may hold part of them only
+func (c Controller) ListSummary(ctx context.Context, q *docs.ListQuery) (summary *docs.ListSummary, err error) {
+	return c.repo.Summary(ctx, q)
+}
+
+// Search finds documents login may read by their words
+func (c Controller) Search(ctx context.Context, login, text string, limit int) (results []*docs.SearchResult, err error) {
+	return c.repo.Search(ctx, login, text, limit)
+}
+
+// ListPublic lists documents of owner anyone may read
+func (c Controller) ListPublic(ctx context.Context, owner string, limit int) (docs []*docs.Meta, err error) {
+	return c.repo.ListPublic(ctx, owner, limit)
+}
+
+// GetMeta returns document login may read, expired ones are
+// reported with docs.ErrExpired until they are reaped
 func (c Controller) GetMeta(ctx context.Context, id, login string) (doc *docs.Meta, err error) {
 	doc = c.cache.Get(id, login)
 
 	if doc == nil {
-		return c.repo.GetMeta(ctx, id, login)
+		doc, err = c.repo.GetMeta(ctx, id, login)
+		if err != nil {
+			return nil, err
+		}
 	}
+
+	if doc.Expired(time.Now()) {
+		return nil, docs.ErrExpired
+	}
+
 	return
 }
 
-func (c Controller) ReadFileStream(ctx context.Context, oid uint32, writer io.Writer) (err error) {
-	return c.repo.ReadFile(ctx, oid, writer)
+func (c Controller) ReadFileStream(ctx context.Context, key string, writer io.Writer) (err error) {
+	return c.repo.ReadFile(ctx, key, writer)
+}
+
+func (c Controller) ReadFileRange(ctx context.Context, key string, start, length int64, writer io.Writer) (err error) {
+	return c.repo.ReadFileRange(ctx, key, start, length, writer)
 }
 
-func (c Controller) ReadJSON(ctx context.Context, id string) (json json.RawMessage, err error) {
-	return c.repo.ReadJSON(ctx, id)
+// ReadJSON reads json document, or its part at path if given
+func (c Controller) ReadJSON(ctx context.Context, id, path string) (json json.RawMessage, err error) {
+	return c.repo.ReadJSON(ctx, id, path)
 }
 
-func (c Controller) Delete(ctx context.Context, id string) (err error) {
+// authorize returns document if login may do what perm requires.
+// Documents login can not even read are reported missing
+func (c Controller) authorize(ctx context.Context, id, login string, perm docs.Permission) (meta *docs.Meta, err error) {
+	meta, err = c.GetMeta(ctx, id, login)
+	if err != nil {
+		return nil, err
+	}
+
+	if !meta.Allowed(login, perm) {
+		return nil, docs.ErrForbidden
+	}
+
+	return
+}
+
+func (c Controller) Delete(ctx context.Context, login, id, ifMatch string) (err error) {
+	err = c.repo.Delete(ctx, login, id, ifMatch)
+	if err != nil {
+		return
+	}
+
 	c.cache.Remove(id)
-	return c.repo.Delete(ctx, id)
+
+	return
 }
 
 func (c Controller) FreeCache(ctx context.Context, login string) (err error) {
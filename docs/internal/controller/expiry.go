@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"context"
+)
+
+// reapBatch is how many expired documents are removed in one transaction
+const reapBatch = 100
+
+// ReapExpired removes expired documents batch by batch
+// and drops them from cache
+func (c Controller) ReapExpired(ctx context.Context) (count int, err error) {
+	for {
+		var ids []string
+		ids, err = c.repo.Reap(ctx, reapBatch)
+		if err != nil {
+			return count, err
+		}
+
+		c.uncache(ids)
+		count += len(ids)
+
+		if len(ids) < reapBatch || ctx.Err() != nil {
+			return count, nil
+		}
+	}
+}
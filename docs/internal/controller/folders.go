@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+	"github.com/google/uuid"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+func (c Controller) CreateFolder(ctx context.Context, folder *docs.Folder) (err error) {
+	folder.ID = uuid.New().String()
+
+	return c.repo.CreateFolder(ctx, folder)
+}
+
+// GetFolder returns folder login may read, others are reported missing
+func (c Controller) GetFolder(ctx context.Context, login, id string) (folder *docs.Folder, err error) {
+	folder, err = c.repo.GetFolder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !folder.Allowed(login, docs.PermissionRead) {
+		return nil, docs.ErrNoFolder
+	}
+
+	return
+}
+
+// ListFolders lists folders inside of parentID login may read,
+// login folders at root if parentID is empty
+func (c Controller) ListFolders(ctx context.Context, login, parentID string) (folders []*docs.Folder, err error) {
+	if parentID != "" {
+		_, err = c.GetFolder(ctx, login, parentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c.repo.ListFolders(ctx, login, parentID)
+}
+
+// UpdateFolder renames and moves folder of its owner only
+func (c Controller) UpdateFolder(ctx context.Context, login, id string, name, parentID *string) (folder *docs.Folder, err error) {
+	err = c.ownFolder(ctx, login, id)
+	if err != nil {
+		return nil, err
+	}
+
+	folder, changed, err := c.repo.UpdateFolder(ctx, login, id, name, parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.uncache(changed)
+
+	return
+}
+
+func (c Controller) DeleteFolder(ctx context.Context, login, id string) (err error) {
+	err = c.ownFolder(ctx, login, id)
+	if err != nil {
+		return
+	}
+
+	return c.repo.DeleteFolder(ctx, login, id)
+}
+
+func (c Controller) SetFolderGrant(ctx context.Context, login, id string, grant docs.Grant) (folder *docs.Folder, err error) {
+	folder, changed, err := c.repo.SetFolderGrant(ctx, login, id, grant)
+	if err != nil {
+		return nil, err
+	}
+
+	c.uncache(changed)
+
+	return
+}
+
+func (c Controller) RevokeFolderGrant(ctx context.Context, login, id, grantee string) (folder *docs.Folder, err error) {
+	folder, changed, err := c.repo.RevokeFolderGrant(ctx, login, id, grantee)
+	if err != nil {
+		return nil, err
+	}
+
+	c.uncache(changed)
+
+	return
+}
+
+// ownFolder tells grantees, who may not change folders, from strangers
+func (c Controller) ownFolder(ctx context.Context, login, id string) (err error) {
+	folder, err := c.GetFolder(ctx, login, id)
+	if err != nil {
+		return
+	}
+
+	if folder.Owner != login {
+		return docs.ErrForbidden
+	}
+
+	return
+}
+
+// uncache drops documents from cache, after their inherited grants
+// change or they are gone. They are read from repository next time
+func (c Controller) uncache(ids []string) {
+	for _, id := range ids {
+		c.cache.Remove(id)
+	}
+}
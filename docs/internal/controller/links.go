@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// CreateLink shares document with anyone holding the link,
+// link.URL is set to signed path to download from.
+// Zero link.ExpiresTs means default link lifetime
+func (c Controller) CreateLink(ctx context.Context, login, id string, link *docs.Link, password string) (err error) {
+	_, err = c.authorize(ctx, id, login, docs.PermissionShare)
+	if err != nil {
+		return
+	}
+
+	var hash []byte
+	if password != "" {
+		hash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return
+		}
+	}
+
+	if link.ExpiresTs == 0 {
+		link.ExpiresTs = time.Now().Add(c.linkTTL).Unix()
+	}
+
+	link.ID = uuid.New().String()
+	link.DocID = id
+	link.Owner = login
+
+	err = c.links.Save(ctx, link, hash)
+	if err != nil {
+		return
+	}
+
+	link.Expires = time.Unix(link.ExpiresTs, 0).Format(time.DateTime)
+	link.URL = fmt.Sprintf("/links/%s?expires=%d&sig=%s", link.ID, link.ExpiresTs, c.sign(link.ID, link.ExpiresTs))
+
+	return
+}
+
+func (c Controller) ListLinks(ctx context.Context, login, id string) (links []*docs.Link, err error) {
+	_, err = c.authorize(ctx, id, login, docs.PermissionShare)
+	if err != nil {
+		return
+	}
+
+	return c.links.List(ctx, id)
+}
+
+func (c Controller) RevokeLink(ctx context.Context, login, id, linkID string) (err error) {
+	_, err = c.authorize(ctx, id, login, docs.PermissionShare)
+	if err != nil {
+		return
+	}
+
+	return c.links.Revoke(ctx, id, linkID)
+}
+
+// OpenLink checks link signature, expiry and password and returns
+// shared document. Download spends one of link downloads
+func (c Controller) OpenLink(ctx context.Context, linkID string, expires int64, sig, password string) (meta *docs.Meta, err error) {
+	expected := c.sign(linkID, expires)
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return nil, docs.ErrBadLink
+	}
+
+	if time.Now().Unix() >= expires {
+		return nil, docs.ErrLinkExpired
+	}
+
+	link, hash, err := c.links.Get(ctx, linkID)
+	if err != nil {
+		return nil, err
+	}
+
+	if link.Revoked {
+		return nil, docs.ErrNoLink
+	}
+
+	if hash != nil {
+		err = bcrypt.CompareHashAndPassword(hash, []byte(password))
+		if err != nil {
+			return nil, docs.ErrLinkPassword
+		}
+	}
+
+	meta, err = c.repo.FindMeta(ctx, link.DocID)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta.Expired(time.Now()) {
+		return nil, docs.ErrExpired
+	}
+
+	return
+}
+
+// UseLink spends one download of link opened, ErrLinkExpired
+// if there are none left
+func (c Controller) UseLink(ctx context.Context, linkID string) (err error) {
+	return c.links.Use(ctx, linkID)
+}
+
+func (c Controller) sign(linkID string, expires int64) string {
+	mac := hmac.New(sha256.New, c.secret)
+	fmt.Fprintf(mac, "%s.%d", linkID, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
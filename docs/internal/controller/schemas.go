@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"context"
+	"github.com/bd878/doc_server/docs/internal/jsonschema"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// SaveSchema creates or replaces schema of its owner, schemas
+// validator does not support are rejected with docs.ErrBadSchema
+func (c Controller) SaveSchema(ctx context.Context, schema *docs.Schema) (err error) {
+	_, err = jsonschema.Compile(schema.Schema)
+	if err != nil {
+		return
+	}
+
+	return c.repo.SaveSchema(ctx, schema)
+}
+
+func (c Controller) ListSchemas(ctx context.Context, owner string) (schemas []*docs.Schema, err error) {
+	return c.repo.ListSchemas(ctx, owner)
+}
+
+func (c Controller) GetSchema(ctx context.Context, owner, name string) (schema *docs.Schema, err error) {
+	return c.repo.GetSchema(ctx, owner, name)
+}
+
+func (c Controller) DeleteSchema(ctx context.Context, owner, name string) (err error) {
+	return c.repo.DeleteSchema(ctx, owner, name)
+}
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"time"
+	"context"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// ListTrash lists deleted documents login may restore
+func (c Controller) ListTrash(ctx context.Context, login string) (docs []*docs.Meta, err error) {
+	return c.repo.ListTrash(ctx, login)
+}
+
+func (c Controller) RestoreTrash(ctx context.Context, login, id string) (meta *docs.Meta, err error) {
+	meta, err = c.repo.RestoreTrash(ctx, login, id)
+	if err != nil {
+		return
+	}
+
+	c.recache(meta)
+
+	return
+}
+
+// purgeBatch is how many trashed documents are removed in one transaction
+const purgeBatch = 100
+
+// PurgeTrash removes documents deleted longer than trash lifetime ago
+// batch by batch
+func (c Controller) PurgeTrash(ctx context.Context) (count int, err error) {
+	before := time.Now().Add(-c.trashTTL)
+	for {
+		var ids []string
+		ids, err = c.repo.Purge(ctx, before, purgeBatch)
+		if err != nil {
+			return count, err
+		}
+
+		count += len(ids)
+
+		if len(ids) < purgeBatch || ctx.Err() != nil {
+			return count, nil
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"io"
+	"time"
+	"context"
+	"github.com/google/uuid"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// CreateUpload starts resumable upload of file document,
+// meta is not nil if upload is empty and so complete already
+func (c Controller) CreateUpload(ctx context.Context, upload *docs.Upload) (meta *docs.Meta, err error) {
+	upload.ID = uuid.New().String()
+	upload.DocID = uuid.New().String()
+	upload.ExpiresTs = time.Now().Add(c.uploadTTL).Unix()
+
+	meta, err = c.uploads.Create(ctx, upload)
+	if err != nil {
+		return
+	}
+
+	if meta != nil {
+		c.cache.Set(meta.Owner, meta)
+	}
+
+	return
+}
+
+func (c Controller) GetUpload(ctx context.Context, login, id string) (upload *docs.Upload, err error) {
+	return c.uploads.Get(ctx, id, login)
+}
+
+// WriteUpload appends chunk at offset, meta is the document
+// created when the last chunk arrives
+func (c Controller) WriteUpload(ctx context.Context, login, id string, offset int64, chunk io.Reader) (upload *docs.Upload, meta *docs.Meta, err error) {
+	upload, meta, err = c.uploads.Write(ctx, id, login, offset, chunk)
+	if err != nil {
+		return
+	}
+
+	if meta != nil {
+		c.cache.Set(meta.Owner, meta)
+	}
+
+	return
+}
+
+func (c Controller) DeleteUpload(ctx context.Context, login, id string) (err error) {
+	return c.uploads.Delete(ctx, id, login)
+}
+
+// ExpireUploads removes uploads abandoned for longer than upload lifetime
+func (c Controller) ExpireUploads(ctx context.Context) (count int, err error) {
+	return c.uploads.Expire(ctx)
+}
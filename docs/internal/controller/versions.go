@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"context"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// ListVersions returns current version number and previous versions
+func (c Controller) ListVersions(ctx context.Context, login, id string) (current int, versions []*docs.Version, err error) {
+	meta, err := c.authorize(ctx, id, login, docs.PermissionRead)
+	if err != nil {
+		return
+	}
+
+	versions, err = c.repo.ListVersions(ctx, id)
+	if err != nil {
+		return
+	}
+
+	return meta.Version, versions, nil
+}
+
+func (c Controller) GetVersion(ctx context.Context, login, id string, n int) (version *docs.Version, json []byte, err error) {
+	_, err = c.authorize(ctx, id, login, docs.PermissionRead)
+	if err != nil {
+		return
+	}
+
+	return c.repo.GetVersion(ctx, id, n)
+}
+
+func (c Controller) Restore(ctx context.Context, login, id string, n int) (meta *docs.Meta, err error) {
+	_, err = c.authorize(ctx, id, login, docs.PermissionWrite)
+	if err != nil {
+		return
+	}
+
+	meta, err = c.repo.Restore(ctx, id, n)
+	if err != nil {
+		return
+	}
+
+	c.recache(meta)
+
+	return
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+	"encoding/hex"
+	"encoding/base64"
+)
+
+// writeDigest sets file content digest, as Digest (RFC 3230) for older
+// clients and Content-Digest (RFC 9530). Content-Digest covers response
+// body, so it is left out when only parts of the file are sent
+func (h handlers) writeDigest(w http.ResponseWriter, sum string, whole bool) {
+	digest, err := hex.DecodeString(sum)
+	if err != nil || len(digest) == 0 {
+		return
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(digest)
+
+	w.Header().Set("Digest", "SHA-256=" + encoded)
+	if whole {
+		w.Header().Set("Content-Digest", "sha-256=:" + encoded + ":")
+	}
+}
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"encoding/json"
+	server "github.com/bd878/doc_server/pkg/model"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+func (h handlers) CreateFolder(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseMultipartForm(1024 /* 1 KB */)
+	if err != nil && err != http.ErrNotMultipart {
+		h.logger.Error().Err(err).Msg("failed to parse form")
+
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoForm,
+				Text: "failed to parse form",
+			},
+		})
+		return
+	}
+
+	owner, ok := h.authToken(w, req)
+	if !ok {
+		return
+	}
+
+	folder := &docs.Folder{
+		Owner:    owner,
+		ParentID: req.FormValue("parent_id"),
+		Name:     req.FormValue("name"),
+		Grant:    make([]docs.Grant, 0),
+	}
+
+	if !docs.ValidFolderName(folder.Name) {
+		h.writeBadFolderName(w)
+		return
+	}
+
+	err = h.ctrl.CreateFolder(req.Context(), folder)
+	if err != nil {
+		if h.writeFolderError(w, err) {
+			return
+		}
+		h.logger.Error().Err(err).Msg("failed to create folder")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.writeFolder(w, folder)
+}
+
+// ListFolders lists folders inside of parent_id one,
+// login folders at root without it
+func (h handlers) ListFolders(w http.ResponseWriter, req *http.Request) {
+	login, ok := h.authToken(w, req)
+	if !ok {
+		return
+	}
+
+	folders, err := h.ctrl.ListFolders(req.Context(), login, req.FormValue("parent_id"))
+	if err != nil {
+		if h.writeFolderError(w, err) {
+			return
+		}
+		h.logger.Error().Err(err).Msg("failed to list folders")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response, err := json.Marshal(docs.FoldersResponse{
+		Folders: folders,
+	})
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Data: json.RawMessage(response),
+	})
+}
+
+func (h handlers) GetFolder(w http.ResponseWriter, req *http.Request) {
+	login, ok := h.authToken(w, req)
+	if !ok {
+		return
+	}
+
+	folder, err := h.ctrl.GetFolder(req.Context(), login, req.PathValue("id"))
+	if err != nil {
+		if h.writeFolderError(w, err) {
+			return
+		}
+		h.logger.Error().Err(err).Msg("failed to get folder")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.writeFolder(w, folder)
+}
+
+// UpdateFolder renames folder and moves it to parent_id,
+// empty parent_id moves folder to root
+func (h handlers) UpdateFolder(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseMultipartForm(1024 /* 1 KB */)
+	if err != nil && err != http.ErrNotMultipart {
+		h.logger.Error().Err(err).Msg("failed to parse form")
+
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoForm,
+				Text: "failed to parse form",
+			},
+		})
+		return
+	}
+
+	login, ok := h.authToken(w, req)
+	if !ok {
+		return
+	}
+
+	var name, parentID *string
+	if req.Form.Has("name") {
+		value := req.Form.Get("name")
+		if !docs.ValidFolderName(value) {
+			h.writeBadFolderName(w)
+			return
+		}
+		name = &value
+	}
+	if req.Form.Has("parent_id") {
+		value := req.Form.Get("parent_id")
+		parentID = &value
+	}
+
+	if name == nil && parentID == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeBadFolder,
+				Text: "name or parent_id required",
+			},
+		})
+		return
+	}
+
+	folder, err := h.ctrl.UpdateFolder(req.Context(), login, req.PathValue("id"), name, parentID)
+	if err != nil {
+		if h.writeFolderError(w, err) {
+			return
+		}
+		h.logger.Error().Err(err).Msg("failed to update folder")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.writeFolder(w, folder)
+}
+
+func (h handlers) DeleteFolder(w http.ResponseWriter, req *http.Request) {
+	login, ok := h.authToken(w, req)
+	if !ok {
+		return
+	}
+
+	err := h.ctrl.DeleteFolder(req.Context(), login, req.PathValue("id"))
+	if err != nil {
+		if h.writeFolderError(w, err) {
+			return
+		}
+		h.logger.Error().Err(err).Msg("failed to delete folder")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetFolderGrant grants login permission on folder and
+// everything inside of it
+func (h handlers) SetFolderGrant(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseMultipartForm(1024 /* 1 KB */)
+	if err != nil && err != http.ErrNotMultipart {
+		h.logger.Error().Err(err).Msg("failed to parse form")
+
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoForm,
+				Text: "failed to parse form",
+			},
+		})
+		return
+	}
+
+	login, ok := h.authToken(w, req)
+	if !ok {
+		return
+	}
+
+	grant := docs.Grant{
+		Login:      req.FormValue("login"),
+		Permission: docs.Permission(req.FormValue("permission")),
+	}
+
+	if grant.Login == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeNoGrantee,
+				Text: "login required",
+			},
+		})
+		return
+	}
+
+	if grant.Permission == "" {
+		grant.Permission = docs.PermissionRead
+	}
+
+	if !grant.Permission.Valid() {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeBadGrant,
+				Text: "permission must be one of read, write, share",
+			},
+		})
+		return
+	}
+
+	folder, err := h.ctrl.SetFolderGrant(req.Context(), login, req.PathValue("id"), grant)
+	if err != nil {
+		if h.writeFolderError(w, err) {
+			return
+		}
+		h.logger.Error().Err(err).Msg("failed to set folder grant")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.writeFolder(w, folder)
+}
+
+func (h handlers) RevokeFolderGrant(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	login, ok := h.authToken(w, req)
+	if !ok {
+		return
+	}
+
+	grantee := req.FormValue("login")
+	if grantee == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeNoGrantee,
+				Text: "login required",
+			},
+		})
+		return
+	}
+
+	folder, err := h.ctrl.RevokeFolderGrant(req.Context(), login, req.PathValue("id"), grantee)
+	if err != nil {
+		if h.writeFolderError(w, err) {
+			return
+		}
+		h.logger.Error().Err(err).Msg("failed to revoke folder grant")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.writeFolder(w, folder)
+}
+
+func (h handlers) writeFolder(w http.ResponseWriter, folder *docs.Folder) {
+	response, err := json.Marshal(folder)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Data: json.RawMessage(response),
+	})
+}
+
+func (h handlers) writeNoFolder(w http.ResponseWriter, status int) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Error: &server.ErrorCode{
+			Code: docs.CodeNoFolder,
+			Text: "no folder",
+		},
+	})
+}
+
+func (h handlers) writeBadFolderName(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Error: &server.ErrorCode{
+			Code: docs.CodeBadFolder,
+			Text: "bad folder name",
+		},
+	})
+}
+
+// writeFolderError writes errors of folder operations,
+// false if err is none of them
+func (h handlers) writeFolderError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == docs.ErrNoFolder:
+		h.writeNoFolder(w, http.StatusNotFound)
+	case errors.Is(err, docs.ErrBadFolder):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeBadFolder,
+				Text: err.Error(),
+			},
+		})
+	case err == docs.ErrFolderExists:
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeFolderExists,
+				Text: "folder of the name exists",
+			},
+		})
+	case err == docs.ErrFolderNotEmpty:
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeFolderNotEmpty,
+				Text: "folder not empty",
+			},
+		})
+	case err == docs.ErrForbidden:
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeForbidden,
+				Text: "forbidden",
+			},
+		})
+	case err == docs.ErrBadPermission:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeBadGrant,
+				Text: "owner can not be a grantee",
+			},
+		})
+	case err == docs.ErrNoGrant:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeNoGrant,
+				Text: "no grant",
+			},
+		})
+	default:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"io"
+	"time"
+	"net/http"
+	"mime/multipart"
+	"encoding/json"
+	server "github.com/bd878/doc_server/pkg/model"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// metaPartSize bounds meta part and form overhead around content
+const metaPartSize = 1 << 20 /* 1 MB */
+
+// docForm is document form read part by part, meta comes first,
+// then file or json. Other parts before content are skipped, so forms
+// sending both json and file work for either kind of document.
+// Content is not read until caller consumes it
+type docForm struct {
+	meta    docs.SaveMeta
+	login   string
+	expires time.Time // zero if document never expires
+	file    io.Reader
+	json    []byte
+}
+
+// readDocForm reads meta part and authenticates its token before
+// touching content, so strangers can not make server read large bodies
+func (h handlers) readDocForm(w http.ResponseWriter, req *http.Request) (form *docForm, ok bool) {
+	if h.maxFileSize > 0 && req.ContentLength > h.maxFileSize + metaPartSize {
+		h.writeTooLarge(w)
+		return nil, false
+	}
+
+	mr, err := req.MultipartReader()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to read form")
+		h.writeNoForm(w)
+		return nil, false
+	}
+
+	part, err := mr.NextPart()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to read form part")
+		h.writeNoForm(w)
+		return nil, false
+	}
+
+	if part.FormName() != "meta" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeNoMeta,
+				Text: "meta must be first form part",
+			},
+		})
+		return nil, false
+	}
+
+	form = &docForm{}
+
+	err = json.NewDecoder(io.LimitReader(part, metaPartSize)).Decode(&form.meta)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to unmarshal meta")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeNoMeta,
+				Text: "bad meta",
+			},
+		})
+		return nil, false
+	}
+
+	if form.meta.Token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoToken,
+				Text: "no token",
+			},
+		})
+		return nil, false
+	}
+
+	form.login, err = h.gateway.Auth(req.Context(), form.meta.Token)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to auth")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoUser,
+				Text: "not authorized",
+			},
+		})
+		return nil, false
+	}
+
+	if form.login == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil, false
+	}
+
+	form.meta.Tags, err = docs.CleanTags(form.meta.Tags)
+	if err == nil {
+		err = docs.CheckMetadata(form.meta.Metadata)
+	}
+	if err != nil {
+		h.writeBadMetadata(w, err)
+		return nil, false
+	}
+
+	form.expires, ok = h.readExpiry(w, form.meta.Expires)
+	if !ok {
+		return nil, false
+	}
+
+	name := "json"
+	if form.meta.File {
+		name = "file"
+	}
+
+	part, err = nextPart(mr, name)
+	if err == docs.ErrFileTooLarge {
+		h.writeTooLarge(w)
+		return nil, false
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to read form part")
+		h.writeNoForm(w)
+		return nil, false
+	}
+
+	if form.meta.File {
+		if part == nil || part.FormName() != "file" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeNoFile,
+					Text: "file required",
+				},
+			})
+			return nil, false
+		}
+
+		form.file = &sizeLimitReader{r: part, limit: h.maxFileSize}
+		return form, true
+	}
+
+	if part != nil {
+		// json is read in memory, its limit is well below one of files
+		form.json, err = io.ReadAll(&sizeLimitReader{r: part, limit: h.maxJSONSize})
+		if err == docs.ErrFileTooLarge {
+			h.writeTooLarge(w)
+			return nil, false
+		}
+		if err != nil {
+			h.logger.Error().Err(err).Msg("failed to read json part")
+			h.writeNoForm(w)
+			return nil, false
+		}
+	}
+
+	if len(form.json) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeNoJSON,
+				Text: "json required",
+			},
+		})
+		return nil, false
+	}
+
+	// json documents are kept as jsonb, content must be json then
+	if !json.Valid(form.json) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeNoJSON,
+				Text: "bad json",
+			},
+		})
+		return nil, false
+	}
+
+	return form, true
+}
+
+// nextPart skips form parts up to one of name, nil if there is none.
+// Skipped parts count against metaPartSize, as meta does
+func nextPart(mr *multipart.Reader, name string) (*multipart.Part, error) {
+	var skipped int64
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == name {
+			return part, nil
+		}
+
+		n, err := io.Copy(io.Discard, io.LimitReader(part, metaPartSize - skipped + 1))
+		if err != nil {
+			return nil, err
+		}
+		skipped += n
+		if skipped > metaPartSize {
+			return nil, docs.ErrFileTooLarge
+		}
+	}
+}
+
+func (h handlers) writeTooLarge(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Error: &server.ErrorCode{
+			Code: docs.CodeFileTooLarge,
+			Text: "document too large",
+		},
+	})
+}
+
+func (h handlers) writeChecksumMismatch(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Error: &server.ErrorCode{
+			Code: docs.CodeChecksum,
+			Text: "file does not match sha256",
+		},
+	})
+}
+
+func (h handlers) writeMimeDenied(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusUnsupportedMediaType)
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Error: &server.ErrorCode{
+			Code: docs.CodeMimeDenied,
+			Text: "mime type not allowed",
+		},
+	})
+}
+
+// readExpiry parses expires_at value, which must be in the future
+func (h handlers) readExpiry(w http.ResponseWriter, value string) (expires time.Time, ok bool) {
+	expires, err := docs.ParseExpiry(value)
+	if err != nil || (!expires.IsZero() && !expires.After(time.Now())) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeBadExpiry,
+				Text: "expires_at must be RFC 3339 time in the future",
+			},
+		})
+		return time.Time{}, false
+	}
+
+	return expires, true
+}
+
+// writeExpired tells document is gone, it is not reaped yet
+func (h handlers) writeExpired(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusGone)
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Error: &server.ErrorCode{
+			Code: docs.CodeExpired,
+			Text: "document expired",
+		},
+	})
+}
+
+func (h handlers) writeBadMetadata(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Error: &server.ErrorCode{
+			Code: docs.CodeBadMetadata,
+			Text: err.Error(),
+		},
+	})
+}
+
+func (h handlers) writeNoForm(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Error: &server.ErrorCode{
+			Code: server.CodeNoForm,
+			Text: "failed to parse form",
+		},
+	})
+}
+
+// sizeLimitReader fails with ErrFileTooLarge instead of silently
+// truncating content, zero limit means no limit
+type sizeLimitReader struct {
+	r      io.Reader
+	limit  int64
+	read   int64
+}
+
+func (s *sizeLimitReader) Read(p []byte) (n int, err error) {
+	n, err = s.r.Read(p)
+	s.read += int64(n)
+	if s.limit > 0 && s.read > s.limit {
+		return n, docs.ErrFileTooLarge
+	}
+	return
+}
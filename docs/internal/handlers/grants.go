@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"net/http"
+	"encoding/json"
+	server "github.com/bd878/doc_server/pkg/model"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+func (h handlers) SetGrant(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseMultipartForm(1024 /* 1 KB */)
+	if err != nil && err != http.ErrNotMultipart {
+		h.logger.Error().Err(err).Msg("failed to parse form")
+
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoForm,
+				Text: "failed to parse form",
+			},
+		})
+		return
+	}
+
+	token := req.FormValue("token")
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoToken,
+				Text: "no token",
+			},
+		})
+		return
+	}
+
+	login, err := h.gateway.Auth(req.Context(), token)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to auth")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoUser,
+				Text: "not authorized",
+			},
+		})
+		return
+	}
+
+	if login == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id := req.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	grant := docs.Grant{
+		Login:      req.FormValue("login"),
+		Permission: docs.Permission(req.FormValue("permission")),
+	}
+
+	if grant.Login == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeNoGrantee,
+				Text: "login required",
+			},
+		})
+		return
+	}
+
+	if grant.Permission == "" {
+		grant.Permission = docs.PermissionRead
+	}
+
+	if !grant.Permission.Valid() {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeBadGrant,
+				Text: "permission must be one of read, write, share",
+			},
+		})
+		return
+	}
+
+	meta, err := h.ctrl.SetGrant(req.Context(), login, id, grant)
+	if err != nil {
+		switch err {
+		case docs.ErrExpired:
+			h.writeExpired(w)
+			return
+		case docs.ErrNoDoc:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeDocNotFound,
+					Text: "no document",
+				},
+			})
+			return
+		case docs.ErrForbidden:
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeForbidden,
+					Text: "forbidden",
+				},
+			})
+			return
+		case docs.ErrBadPermission:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeBadGrant,
+					Text: "owner can not be a grantee",
+				},
+			})
+			return
+		default:
+			h.logger.Error().Err(err).Msg("failed to set grant")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	response, err := json.Marshal(meta)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Data: json.RawMessage(response),
+	})
+}
+
+func (h handlers) RevokeGrant(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	token := req.FormValue("token")
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoToken,
+				Text: "no token",
+			},
+		})
+		return
+	}
+
+	login, err := h.gateway.Auth(req.Context(), token)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to auth")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoUser,
+				Text: "not authorized",
+			},
+		})
+		return
+	}
+
+	if login == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id := req.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	grantee := req.FormValue("login")
+	if grantee == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeNoGrantee,
+				Text: "login required",
+			},
+		})
+		return
+	}
+
+	meta, err := h.ctrl.RevokeGrant(req.Context(), login, id, grantee)
+	if err != nil {
+		switch err {
+		case docs.ErrExpired:
+			h.writeExpired(w)
+			return
+		case docs.ErrNoDoc:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeDocNotFound,
+					Text: "no document",
+				},
+			})
+			return
+		case docs.ErrForbidden:
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeForbidden,
+					Text: "forbidden",
+				},
+			})
+			return
+		case docs.ErrNoGrant:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeNoGrant,
+					Text: "no grant",
+				},
+			})
+			return
+		default:
+			h.logger.Error().Err(err).Msg("failed to revoke grant")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	response, err := json.Marshal(meta)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Data: json.RawMessage(response),
+	})
+}
@@ -2,13 +2,14 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
 	"strconv"
 	"encoding/json"
 	"github.com/rs/zerolog"
+	"github.com/bd878/doc_server/internal/ratelimit"
 	server "github.com/bd878/doc_server/pkg/model"
 	docs "github.com/bd878/doc_server/docs/pkg/model"
 )
@@ -18,35 +19,285 @@ type UsersGateway interface {
 }
 
 type Controller interface {
-	List(ctx context.Context, owner, login, key, value string, limit int) (docs []*docs.Meta, err error)
-	Save(ctx context.Context, owner string, f multipart.File, json []byte, meta *docs.Meta) (err error)
+	List(ctx context.Context, q *docs.ListQuery) (docs []*docs.Meta, next string, err error)
+	ListSummary(ctx context.Context, q *docs.ListQuery) (summary *docs.ListSummary, err error)
+	Search(ctx context.Context, login, text string, limit int) (results []*docs.SearchResult, err error)
+	Save(ctx context.Context, owner string, f io.Reader, json []byte, meta *docs.Meta) (err error)
+	Update(ctx context.Context, login, id, ifMatch string, f io.Reader, json []byte, meta *docs.Meta) (err error)
+	UpdateMeta(ctx context.Context, login, id, ifMatch string, patch *docs.UpdateMeta) (meta *docs.Meta, err error)
+	Patch(ctx context.Context, login, id, ifMatch, kind string, patch []byte) (meta *docs.Meta, json []byte, err error)
+	SetGrant(ctx context.Context, login, id string, grant docs.Grant) (meta *docs.Meta, err error)
+	RevokeGrant(ctx context.Context, login, id, grantee string) (meta *docs.Meta, err error)
+	ListPublic(ctx context.Context, owner string, limit int) (docs []*docs.Meta, err error)
 	GetMeta(ctx context.Context, id, login string) (doc *docs.Meta, err error)
-	ReadJSON(ctx context.Context, id string) (json json.RawMessage, err error)
-	ReadFileStream(ctx context.Context, oid uint32, w io.Writer) (err error)
-	Delete(ctx context.Context, id string) (err error)
+	CreateLink(ctx context.Context, login, id string, link *docs.Link, password string) (err error)
+	ListLinks(ctx context.Context, login, id string) (links []*docs.Link, err error)
+	RevokeLink(ctx context.Context, login, id, linkID string) (err error)
+	OpenLink(ctx context.Context, linkID string, expires int64, sig, password string) (meta *docs.Meta, err error)
+	UseLink(ctx context.Context, linkID string) (err error)
+	ListVersions(ctx context.Context, login, id string) (current int, versions []*docs.Version, err error)
+	GetVersion(ctx context.Context, login, id string, n int) (version *docs.Version, json []byte, err error)
+	Restore(ctx context.Context, login, id string, n int) (meta *docs.Meta, err error)
+	ReadJSON(ctx context.Context, id, path string) (json json.RawMessage, err error)
+	ReadFileStream(ctx context.Context, key string, w io.Writer) (err error)
+	ReadFileRange(ctx context.Context, key string, start, length int64, w io.Writer) (err error)
+	Delete(ctx context.Context, login, id, ifMatch string) (err error)
+	CreateUpload(ctx context.Context, upload *docs.Upload) (meta *docs.Meta, err error)
+	GetUpload(ctx context.Context, login, id string) (upload *docs.Upload, err error)
+	WriteUpload(ctx context.Context, login, id string, offset int64, chunk io.Reader) (upload *docs.Upload, meta *docs.Meta, err error)
+	DeleteUpload(ctx context.Context, login, id string) (err error)
+	SaveSchema(ctx context.Context, schema *docs.Schema) (err error)
+	ListSchemas(ctx context.Context, owner string) (schemas []*docs.Schema, err error)
+	GetSchema(ctx context.Context, owner, name string) (schema *docs.Schema, err error)
+	DeleteSchema(ctx context.Context, owner, name string) (err error)
+	CreateFolder(ctx context.Context, folder *docs.Folder) (err error)
+	GetFolder(ctx context.Context, login, id string) (folder *docs.Folder, err error)
+	ListFolders(ctx context.Context, login, parentID string) (folders []*docs.Folder, err error)
+	UpdateFolder(ctx context.Context, login, id string, name, parentID *string) (folder *docs.Folder, err error)
+	DeleteFolder(ctx context.Context, login, id string) (err error)
+	SetFolderGrant(ctx context.Context, login, id string, grant docs.Grant) (folder *docs.Folder, err error)
+	RevokeFolderGrant(ctx context.Context, login, id, grantee string) (folder *docs.Folder, err error)
+	ListTrash(ctx context.Context, login string) (docs []*docs.Meta, err error)
+	RestoreTrash(ctx context.Context, login, id string) (meta *docs.Meta, err error)
 }
 
 type handlers struct {
 	ctrl    Controller
 	logger  zerolog.Logger
 	gateway UsersGateway
+	limiter *ratelimit.Limiter
+	maxFileSize   int64
+	maxJSONSize   int64
+	uploadMaxSize int64
 }
 
-func RegisterHandlers(mux *http.ServeMux, ctrl Controller, gateway UsersGateway, logger zerolog.Logger) {
-	h := &handlers{ctrl, logger, gateway}
+func RegisterHandlers(mux *http.ServeMux, ctrl Controller, gateway UsersGateway, limiter *ratelimit.Limiter, maxFileSize, maxJSONSize, uploadMaxSize int64, logger zerolog.Logger) {
+	h := &handlers{ctrl, logger, gateway, limiter, maxFileSize, maxJSONSize, uploadMaxSize}
 
 	mux.HandleFunc("POST    /api/docs", h.Save)
 	mux.HandleFunc("GET     /api/docs", h.List)
 	mux.HandleFunc("HEAD    /api/docs", h.ListHead)
 	mux.HandleFunc("GET     /api/docs/{id}", h.Get)
 	mux.HandleFunc("HEAD    /api/docs/{id}", h.GetHead)
+	mux.HandleFunc("PUT     /api/docs/{id}", h.Update)
+	mux.HandleFunc("PATCH   /api/docs/{id}", h.UpdateMeta)
 	mux.HandleFunc("DELETE  /api/docs/{id}", h.Delete)
+	mux.HandleFunc("POST    /api/docs/{id}/grants", h.SetGrant)
+	mux.HandleFunc("DELETE  /api/docs/{id}/grants", h.RevokeGrant)
+
+	mux.HandleFunc("GET     /api/docs/{id}/versions", h.ListVersions)
+	mux.HandleFunc("GET     /api/docs/{id}/versions/{n}", h.GetVersion)
+	mux.HandleFunc("POST    /api/docs/{id}/versions/{n}/restore", h.RestoreVersion)
+	mux.HandleFunc("POST    /api/docs/{id}/links", h.CreateLink)
+	mux.HandleFunc("GET     /api/docs/{id}/links", h.ListLinks)
+	mux.HandleFunc("DELETE  /api/docs/{id}/links/{link}", h.RevokeLink)
+	mux.HandleFunc("GET     /links/{link}", h.OpenLink)
+
+	mux.HandleFunc("OPTIONS /api/uploads", h.UploadOptions)
+	mux.HandleFunc("POST    /api/uploads", h.CreateUpload)
+	mux.HandleFunc("HEAD    /api/uploads/{id}", h.GetUploadOffset)
+	mux.HandleFunc("PATCH   /api/uploads/{id}", h.WriteUpload)
+	mux.HandleFunc("DELETE  /api/uploads/{id}", h.DeleteUpload)
+
+	mux.HandleFunc("GET     /api/schemas", h.ListSchemas)
+	mux.HandleFunc("GET     /api/schemas/{name}", h.GetSchema)
+	mux.HandleFunc("PUT     /api/schemas/{name}", h.SaveSchema)
+	mux.HandleFunc("DELETE  /api/schemas/{name}", h.DeleteSchema)
+
+	mux.HandleFunc("POST    /api/folders", h.CreateFolder)
+	mux.HandleFunc("GET     /api/folders", h.ListFolders)
+	mux.HandleFunc("GET     /api/folders/{id}", h.GetFolder)
+	mux.HandleFunc("PATCH   /api/folders/{id}", h.UpdateFolder)
+	mux.HandleFunc("DELETE  /api/folders/{id}", h.DeleteFolder)
+	mux.HandleFunc("POST    /api/folders/{id}/grants", h.SetFolderGrant)
+	mux.HandleFunc("DELETE  /api/folders/{id}/grants", h.RevokeFolderGrant)
+
+	mux.HandleFunc("GET     /api/trash", h.ListTrash)
+	mux.HandleFunc("POST    /api/trash/{id}/restore", h.RestoreTrash)
+
+	mux.HandleFunc("GET     /public/docs", h.PublicList)
+	mux.HandleFunc("GET     /public/docs/{id}", h.PublicGet)
 }
 
 func (h handlers) Save(w http.ResponseWriter, req *http.Request) {
-	var meta docs.SaveMeta
+	form, ok := h.readDocForm(w, req)
+	if !ok {
+		return
+	}
+
+	meta := form.meta
+
+	doc := &docs.Meta{
+		Name:     meta.Name,
+		File:     meta.File,
+		Mime:     meta.Mime,
+		Public:   meta.Public,
+		Grant:    meta.Grant,
+		MaxVersions: meta.MaxVersions,
+		SHA256:   meta.SHA256,
+		Schema:   meta.Schema,
+		ParentID: meta.ParentID,
+		Tags:     meta.Tags,
+		Metadata: meta.Metadata,
+	}
+	doc.SetExpires(form.expires)
+
+	err := h.ctrl.Save(req.Context(), form.login, form.file, form.json, doc)
+	if err == docs.ErrFileTooLarge {
+		h.writeTooLarge(w)
+		return
+	}
+	if err == docs.ErrChecksum {
+		h.writeChecksumMismatch(w)
+		return
+	}
+	if err == docs.ErrMimeDenied {
+		h.writeMimeDenied(w)
+		return
+	}
+	if err == docs.ErrNoFolder {
+		h.writeNoFolder(w, http.StatusBadRequest)
+		return
+	}
+	if h.writeSchemaError(w, err) {
+		return
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to save file")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", doc.ETag())
+	h.writeDigest(w, doc.SHA256, false)
+
+	response, err := json.Marshal(docs.SaveResponse{
+		ID:     doc.ID,
+		File:   meta.Name,
+		JSON:   json.RawMessage(form.json),
+		SHA256: doc.SHA256,
+	})
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Data: json.RawMessage(response),
+	})
+}
+
+func (h handlers) Update(w http.ResponseWriter, req *http.Request) {
+	id := req.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	form, ok := h.readDocForm(w, req)
+	if !ok {
+		return
+	}
+
+	meta := form.meta
+
+	doc := &docs.Meta{
+		Name:     meta.Name,
+		File:     meta.File,
+		Mime:     meta.Mime,
+		Public:   meta.Public,
+		Grant:    meta.Grant,
+		MaxVersions: meta.MaxVersions,
+		SHA256:   meta.SHA256,
+		Schema:   meta.Schema,
+		Tags:     meta.Tags,
+		Metadata: meta.Metadata,
+	}
+	doc.SetExpires(form.expires)
+
+	err := h.ctrl.Update(req.Context(), form.login, id, req.Header.Get("If-Match"), form.file, form.json, doc)
+	if err != nil {
+		switch err {
+		case docs.ErrExpired:
+			h.writeExpired(w)
+			return
+		case docs.ErrNoDoc:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeDocNotFound,
+					Text: "no document",
+				},
+			})
+			return
+		case docs.ErrForbidden:
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeForbidden,
+					Text: "forbidden",
+				},
+			})
+			return
+		case docs.ErrPrecondition:
+			w.WriteHeader(http.StatusPreconditionFailed)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodePrecondition,
+					Text: "document was changed",
+				},
+			})
+			return
+		case docs.ErrFileTooLarge:
+			h.writeTooLarge(w)
+			return
+		case docs.ErrChecksum:
+			h.writeChecksumMismatch(w)
+			return
+		case docs.ErrMimeDenied:
+			h.writeMimeDenied(w)
+			return
+		default:
+			if h.writeSchemaError(w, err) {
+				return
+			}
+			h.logger.Error().Err(err).Msg("failed to update file")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("ETag", doc.ETag())
+	h.writeDigest(w, doc.SHA256, false)
+
+	response, err := json.Marshal(docs.SaveResponse{
+		ID:     id,
+		File:   meta.Name,
+		JSON:   json.RawMessage(form.json),
+		SHA256: doc.SHA256,
+	})
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Data: json.RawMessage(response),
+	})
+}
 
-	err := req.ParseMultipartForm(10 << 20 /* 10 MB */)
+func (h handlers) UpdateMeta(w http.ResponseWriter, req *http.Request) {
+	// content of json documents is patched on the same route
+	if docs.PatchType(req.Header.Get("Content-Type")) {
+		h.Patch(w, req)
+		return
+	}
+
+	var patch docs.UpdateMeta
+
+	err := req.ParseMultipartForm(1 << 20 /* 1 MB */)
 	if err != nil {
 		h.logger.Error().Err(err).Msg("failed to parse form")
 
@@ -60,6 +311,12 @@ func (h handlers) Save(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	id := req.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	rawMeta := req.PostFormValue("meta")
 	if rawMeta == "" {
 		w.WriteHeader(http.StatusBadRequest)
@@ -72,14 +329,20 @@ func (h handlers) Save(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	err = json.Unmarshal([]byte(rawMeta), &meta)
+	err = json.Unmarshal([]byte(rawMeta), &patch)
 	if err != nil {
 		h.logger.Error().Err(err).Msg("failed to unmarshal meta")
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeNoMeta,
+				Text: "bad meta",
+			},
+		})
 		return
 	}
 
-	if meta.Token == "" {
+	if patch.Token == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(server.ServerResponse{
 			Error: &server.ErrorCode{
@@ -90,7 +353,7 @@ func (h handlers) Save(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	login, err := h.gateway.Auth(req.Context(), meta.Token)
+	login, err := h.gateway.Auth(req.Context(), patch.Token)
 	if err != nil {
 		h.logger.Error().Err(err).Msg("failed to auth")
 		w.WriteHeader(http.StatusUnauthorized)
@@ -108,51 +371,75 @@ func (h handlers) Save(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	var f multipart.File
-	if meta.File {
-		f, _, err = req.FormFile("file")
-		if err != nil {
-			h.logger.Error().Err(err).Msg("failed to read form file")
+	if patch.Tags != nil {
+		*patch.Tags, err = docs.CleanTags(*patch.Tags)
+	}
+	if err == nil && patch.Metadata != nil {
+		err = docs.CheckMetadata(*patch.Metadata)
+	}
+	if err != nil {
+		h.writeBadMetadata(w, err)
+		return
+	}
+
+	if patch.Expires != nil {
+		if _, ok := h.readExpiry(w, *patch.Expires); !ok {
+			return
+		}
+	}
+
+	meta, err := h.ctrl.UpdateMeta(req.Context(), login, id, req.Header.Get("If-Match"), &patch)
+	if err != nil {
+		switch err {
+		case docs.ErrExpired:
+			h.writeExpired(w)
+			return
+		case docs.ErrNoDoc:
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(server.ServerResponse{
 				Error: &server.ErrorCode{
-					Code: docs.CodeNoFile,
-					Text: "file required",
+					Code: docs.CodeDocNotFound,
+					Text: "no document",
+				},
+			})
+			return
+		case docs.ErrForbidden:
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeForbidden,
+					Text: "forbidden",
+				},
+			})
+			return
+		case docs.ErrPrecondition:
+			w.WriteHeader(http.StatusPreconditionFailed)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodePrecondition,
+					Text: "document was changed",
 				},
 			})
 			return
+		case docs.ErrMimeDenied:
+			h.writeMimeDenied(w)
+			return
+		case docs.ErrNoFolder:
+			h.writeNoFolder(w, http.StatusBadRequest)
+			return
+		default:
+			if h.writeSchemaError(w, err) {
+				return
+			}
+			h.logger.Error().Err(err).Msg("failed to update meta")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
 		}
 	}
 
-	jsonData := req.PostFormValue("json")
-	if !meta.File && jsonData == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(server.ServerResponse{
-			Error: &server.ErrorCode{
-				Code: docs.CodeNoJSON,
-				Text: "json required",
-			},
-		})
-		return
-	}
-
-	err = h.ctrl.Save(req.Context(), login, f, []byte(jsonData), &docs.Meta{
-		Name:     meta.Name,
-		File:     meta.File,
-		Mime:     meta.Mime,
-		Public:   meta.Public,
-		Grant:    meta.Grant,
-	})
-	if err != nil {
-		h.logger.Error().Err(err).Msg("failed to save file")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	w.Header().Set("ETag", meta.ETag())
 
-	response, err := json.Marshal(docs.SaveResponse{
-		File: meta.Name,
-		JSON: json.RawMessage(jsonData),
-	})
+	response, err := json.Marshal(meta)
 	if err != nil {
 		h.logger.Error().Err(err).Msg("failed to marshal response")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -202,30 +489,22 @@ func (h handlers) List(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// login lists documents shared with caller, others' shares are not listed
 	login := req.FormValue("login")
-
-	key := req.FormValue("key")
-	if key == "" {
-		w.WriteHeader(http.StatusBadRequest)
+	if login != "" && login != owner {
+		w.WriteHeader(http.StatusForbidden)
 		json.NewEncoder(w).Encode(server.ServerResponse{
 			Error: &server.ErrorCode{
-				Code: docs.CodeNoKey,
-				Text: "no key",
+				Code: docs.CodeForbidden,
+				Text: "forbidden",
 			},
 		})
 		return
 	}
 
-	value := req.FormValue("value")
-	if value == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(server.ServerResponse{
-			Error: &server.ErrorCode{
-				Code: docs.CodeNoValue,
-				Text: "no value",
-			},
-		})
-		return
+	q := &docs.ListQuery{
+		Owner: owner,
+		Login: login,
 	}
 
 	rawLimit := req.FormValue("limit")
@@ -240,9 +519,8 @@ func (h handlers) List(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	limit, err := strconv.Atoi(rawLimit)
-	if err != nil {
-		h.logger.Error().Err(err).Msg("failed to parse limit")
+	q.Limit, err = strconv.Atoi(rawLimit)
+	if err != nil || q.Limit <= 0 {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(server.ServerResponse{
 			Error: &server.ErrorCode{
@@ -253,7 +531,17 @@ func (h handlers) List(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	list, err := h.ctrl.List(req.Context(), owner, login, key, value, limit)
+	err = parseListQuery(req.Form, q)
+	if err != nil {
+		h.writeBadQuery(w, err)
+		return
+	}
+
+	list, next, err := h.ctrl.List(req.Context(), q)
+	if errors.Is(err, docs.ErrBadQuery) {
+		h.writeBadQuery(w, err)
+		return
+	}
 	if err != nil {
 		h.logger.Error().Err(err).Msg("failed to list")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -261,7 +549,8 @@ func (h handlers) List(w http.ResponseWriter, req *http.Request) {
 	}
 
 	response, err := json.Marshal(docs.ListResponse{
-		Docs: list,
+		Docs:       list,
+		NextCursor: next,
 	})
 	if err != nil {
 		h.logger.Error().Err(err).Msg("failed to marshal response")
@@ -274,10 +563,24 @@ func (h handlers) List(w http.ResponseWriter, req *http.Request) {
 	})
 }
 
-func (h handlers) ListHead(w http.ResponseWriter, req *http.Request) {
+func (h handlers) writeBadQuery(w http.ResponseWriter, err error) {
+	code := docs.CodeBadQuery
+	if err == docs.ErrBadCursor {
+		code = docs.CodeBadCursor
+	}
+
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Error: &server.ErrorCode{
+			Code: code,
+			Text: err.Error(),
+		},
+	})
 }
 
-func (h handlers) Get(w http.ResponseWriter, req *http.Request) {
+// ListHead reports what List would find, ignoring limit and cursor,
+// so pollers may skip listing when nothing changed
+func (h handlers) ListHead(w http.ResponseWriter, req *http.Request) {
 	err := req.ParseForm()
 	if err != nil {
 		h.logger.Error().Err(err).Msg("failed to parse form")
@@ -288,79 +591,108 @@ func (h handlers) Get(w http.ResponseWriter, req *http.Request) {
 	token := req.FormValue("token")
 	if token == "" {
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(server.ServerResponse{
-			Error: &server.ErrorCode{
-				Code: server.CodeNoToken,
-				Text: "no token",
-			},
-		})
 		return
 	}
 
-	login, err := h.gateway.Auth(req.Context(), token)
+	owner, err := h.gateway.Auth(req.Context(), token)
 	if err != nil {
 		h.logger.Error().Err(err).Msg("failed to auth")
 		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(server.ServerResponse{
-			Error: &server.ErrorCode{
-				Code: server.CodeNoUser,
-				Text: "not authorized",
-			},
-		})
 		return
 	}
 
-	if login == "" {
+	if owner == "" {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
-	id := req.PathValue("id")
-	if id == "" {
+	login := req.FormValue("login")
+	if login != "" && login != owner {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	q := &docs.ListQuery{
+		Owner: owner,
+		Login: login,
+	}
+
+	req.Form.Del("cursor")
+	err = parseListQuery(req.Form, q)
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	meta, err := h.ctrl.GetMeta(req.Context(), id, login)
+	summary, err := h.ctrl.ListSummary(req.Context(), q)
+	if errors.Is(err, docs.ErrBadQuery) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to summarize list")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", fmt.Sprintf("%d", summary.Count))
+	w.Header().Set("X-Total-Size", fmt.Sprintf("%d", summary.Size))
+	if !summary.Modified.IsZero() {
+		w.Header().Set("Last-Modified", summary.Modified.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h handlers) Get(w http.ResponseWriter, req *http.Request) {
+	// GET /api/docs/search conflicts with HEAD /api/docs/{id} in
+	// ServeMux, so it comes here. Document ids are uuids, never "search"
+	if req.PathValue("id") == "search" {
+		h.Search(w, req)
+		return
+	}
+
+	err := req.ParseForm()
 	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to parse form")
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(server.ServerResponse{
-			Error: &server.ErrorCode{
-				Code: docs.CodeDocNotFound,
-				Text: "document not found",
-			},
-		})
 		return
 	}
 
-	if meta.File {
-		w.Header().Set("Content-Disposition", "attachment; " + "filename*=UTF-8''" + meta.Name)
-		w.Header().Set("Content-Type", meta.Mime)
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", meta.Size))
-		w.Header().Set("Date", meta.Created)
+	var login string
 
-		err = h.ctrl.ReadFileStream(req.Context(), meta.Oid, w)
-		if err != nil {
-			h.logger.Error().Err(err).Msg("failed to read file stream")
-			w.WriteHeader(http.StatusInternalServerError)
+	// no token is fine for public documents
+	token := req.FormValue("token")
+	if token == "" {
+		if !h.allowAnonymous(w, req) {
 			return
 		}
 	} else {
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", meta.Size))
-		w.Header().Set("Date", meta.Created)
-
-		jsonData, err := h.ctrl.ReadJSON(req.Context(), id)
+		login, err = h.gateway.Auth(req.Context(), token)
 		if err != nil {
-			h.logger.Error().Err(err).Msg("failed to read json data")
-			w.WriteHeader(http.StatusInternalServerError)
+			h.logger.Error().Err(err).Msg("failed to auth")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: server.CodeNoUser,
+					Text: "not authorized",
+				},
+			})
 			return
 		}
 
-		json.NewEncoder(w).Encode(server.ServerResponse{
-			Data: jsonData,
-		})
+		if login == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	id := req.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+
+	h.writeDoc(w, req, id, login)
 }
 
 func (h handlers) GetHead(w http.ResponseWriter, req *http.Request) {
@@ -371,37 +703,126 @@ func (h handlers) GetHead(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	var login string
+
 	token := req.FormValue("token")
 	if token == "" {
+		if !h.allowAnonymous(w, req) {
+			return
+		}
+	} else {
+		login, err = h.gateway.Auth(req.Context(), token)
+		if err != nil {
+			h.logger.Error().Err(err).Msg("failed to auth")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if login == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	id := req.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	h.writeHead(w, req, id, login)
+}
+
+// writeDoc writes document content, login is empty for anonymous reader
+func (h handlers) writeDoc(w http.ResponseWriter, req *http.Request, id, login string) {
+	meta, err := h.ctrl.GetMeta(req.Context(), id, login)
+	if err == docs.ErrExpired {
+		h.writeExpired(w)
+		return
+	}
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(server.ServerResponse{
 			Error: &server.ErrorCode{
-				Code: server.CodeNoToken,
-				Text: "no token",
+				Code: docs.CodeDocNotFound,
+				Text: "document not found",
 			},
 		})
 		return
 	}
 
-	login, err := h.gateway.Auth(req.Context(), token)
-	if err != nil {
-		h.logger.Error().Err(err).Msg("failed to auth")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	h.writeContent(w, req, meta)
+}
 
-	if login == "" {
-		w.WriteHeader(http.StatusUnauthorized)
+func (h handlers) writeContent(w http.ResponseWriter, req *http.Request, meta *docs.Meta) {
+	var err error
+
+	// browsers must not guess type of stored content
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", meta.ETag())
+
+	if match := req.Header.Get("If-None-Match"); match != "" && docs.MatchETag(match, meta.ETag(), true) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	id := req.PathValue("id")
-	if id == "" {
-		w.WriteHeader(http.StatusBadRequest)
+	if meta.File {
+		w.Header().Set("Content-Disposition", "attachment; " + "filename*=UTF-8''" + meta.Name)
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Date", meta.Created)
+
+		if header := req.Header.Get("Range"); header != "" && h.rangeFresh(req, meta) && h.writeRanges(w, req, meta, header) {
+			return
+		}
+
+		h.writeDigest(w, meta.SHA256, true)
+
+		w.Header().Set("Content-Type", meta.ContentType())
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", meta.Size))
+
+		err = h.ctrl.ReadFileStream(req.Context(), meta.Blob, w)
+		if err != nil {
+			h.logger.Error().Err(err).Msg("failed to read file stream")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	} else {
+		// json is wrapped in server response, so its size is not a content length
+		w.Header().Set("Date", meta.Created)
+
+		jsonData, err := h.ctrl.ReadJSON(req.Context(), meta.ID, req.URL.Query().Get("path"))
+		if err != nil {
+			switch {
+			case err == docs.ErrNoPath:
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(server.ServerResponse{
+					Error: &server.ErrorCode{
+						Code: docs.CodeNoPath,
+						Text: "nothing at path",
+					},
+				})
+			case errors.Is(err, docs.ErrBadQuery):
+				h.writeBadQuery(w, err)
+			default:
+				h.logger.Error().Err(err).Msg("failed to read json data")
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Data: jsonData,
+		})
 		return
 	}
+}
 
+func (h handlers) writeHead(w http.ResponseWriter, req *http.Request, id, login string) {
 	meta, err := h.ctrl.GetMeta(req.Context(), id, login)
+	if err == docs.ErrExpired {
+		h.writeExpired(w)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(server.ServerResponse{
@@ -413,8 +834,22 @@ func (h handlers) GetHead(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	h.writeMetaHeaders(w, req, meta)
+}
+
+func (h handlers) writeMetaHeaders(w http.ResponseWriter, req *http.Request, meta *docs.Meta) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", meta.ETag())
+
+	if match := req.Header.Get("If-None-Match"); match != "" && docs.MatchETag(match, meta.ETag(), true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	if meta.File {
-		w.Header().Set("Content-Type", meta.Mime)
+		w.Header().Set("Content-Type", meta.ContentType())
+		w.Header().Set("Accept-Ranges", "bytes")
+		h.writeDigest(w, meta.SHA256, true)
 	}
 
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", meta.Size))
@@ -442,7 +877,7 @@ func (h handlers) Delete(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	_, err = h.gateway.Auth(req.Context(), token)
+	login, err := h.gateway.Auth(req.Context(), token)
 	if err != nil {
 		h.logger.Error().Err(err).Msg("failed to auth")
 		w.WriteHeader(http.StatusUnauthorized)
@@ -455,15 +890,23 @@ func (h handlers) Delete(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if login == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
 	id := req.PathValue("id")
 	if id == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	err = h.ctrl.Delete(req.Context(), id)
+	err = h.ctrl.Delete(req.Context(), login, id, req.Header.Get("If-Match"))
 	if err != nil {
 		switch err {
+		case docs.ErrExpired:
+			h.writeExpired(w)
+			return
 		case docs.ErrNoDoc:
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(server.ServerResponse{
@@ -473,6 +916,24 @@ func (h handlers) Delete(w http.ResponseWriter, req *http.Request) {
 				},
 			})
 			return
+		case docs.ErrForbidden:
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeForbidden,
+					Text: "forbidden",
+				},
+			})
+			return
+		case docs.ErrPrecondition:
+			w.WriteHeader(http.StatusPreconditionFailed)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodePrecondition,
+					Text: "document was changed",
+				},
+			})
+			return
 		default:
 			h.logger.Error().Err(err).Msg("failed to delete")
 			w.WriteHeader(http.StatusInternalServerError)
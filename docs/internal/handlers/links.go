@@ -0,0 +1,450 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+	"strconv"
+	"net/http"
+	"encoding/json"
+	server "github.com/bd878/doc_server/pkg/model"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+func (h handlers) CreateLink(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseMultipartForm(1024 /* 1 KB */)
+	if err != nil && err != http.ErrNotMultipart {
+		h.logger.Error().Err(err).Msg("failed to parse form")
+
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoForm,
+				Text: "failed to parse form",
+			},
+		})
+		return
+	}
+
+	token := req.FormValue("token")
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoToken,
+				Text: "no token",
+			},
+		})
+		return
+	}
+
+	login, err := h.gateway.Auth(req.Context(), token)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to auth")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoUser,
+				Text: "not authorized",
+			},
+		})
+		return
+	}
+
+	if login == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id := req.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	link := &docs.Link{}
+
+	if rawExpires := req.FormValue("expires_in"); rawExpires != "" {
+		seconds, err := strconv.ParseInt(rawExpires, 10, 64)
+		if err != nil || seconds <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeBadExpiry,
+					Text: "expires_in must be positive number of seconds",
+				},
+			})
+			return
+		}
+		link.ExpiresTs = time.Now().Unix() + seconds
+	}
+
+	if rawDownloads := req.FormValue("max_downloads"); rawDownloads != "" {
+		link.MaxDownloads, err = strconv.Atoi(rawDownloads)
+		if err != nil || link.MaxDownloads <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeBadDownloads,
+					Text: "max_downloads must be positive number",
+				},
+			})
+			return
+		}
+	}
+
+	err = h.ctrl.CreateLink(req.Context(), login, id, link, req.FormValue("password"))
+	if err != nil {
+		switch err {
+		case docs.ErrExpired:
+			h.writeExpired(w)
+			return
+		case docs.ErrNoDoc:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeDocNotFound,
+					Text: "no document",
+				},
+			})
+			return
+		case docs.ErrForbidden:
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeForbidden,
+					Text: "forbidden",
+				},
+			})
+			return
+		default:
+			h.logger.Error().Err(err).Msg("failed to create link")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	link.URL = fmt.Sprintf("%s://%s%s", scheme, req.Host, link.URL)
+
+	response, err := json.Marshal(link)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Data: json.RawMessage(response),
+	})
+}
+
+func (h handlers) ListLinks(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	token := req.FormValue("token")
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoToken,
+				Text: "no token",
+			},
+		})
+		return
+	}
+
+	login, err := h.gateway.Auth(req.Context(), token)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to auth")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoUser,
+				Text: "not authorized",
+			},
+		})
+		return
+	}
+
+	if login == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id := req.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	links, err := h.ctrl.ListLinks(req.Context(), login, id)
+	if err != nil {
+		switch err {
+		case docs.ErrExpired:
+			h.writeExpired(w)
+			return
+		case docs.ErrNoDoc:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeDocNotFound,
+					Text: "no document",
+				},
+			})
+			return
+		case docs.ErrForbidden:
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeForbidden,
+					Text: "forbidden",
+				},
+			})
+			return
+		default:
+			h.logger.Error().Err(err).Msg("failed to list links")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	response, err := json.Marshal(docs.LinksResponse{
+		Links: links,
+	})
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Data: json.RawMessage(response),
+	})
+}
+
+func (h handlers) RevokeLink(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	token := req.FormValue("token")
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoToken,
+				Text: "no token",
+			},
+		})
+		return
+	}
+
+	login, err := h.gateway.Auth(req.Context(), token)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to auth")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoUser,
+				Text: "not authorized",
+			},
+		})
+		return
+	}
+
+	if login == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id, linkID := req.PathValue("id"), req.PathValue("link")
+	if id == "" || linkID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = h.ctrl.RevokeLink(req.Context(), login, id, linkID)
+	if err != nil {
+		switch err {
+		case docs.ErrExpired:
+			h.writeExpired(w)
+			return
+		case docs.ErrNoDoc:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeDocNotFound,
+					Text: "no document",
+				},
+			})
+			return
+		case docs.ErrForbidden:
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeForbidden,
+					Text: "forbidden",
+				},
+			})
+			return
+		case docs.ErrNoLink:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeNoLink,
+					Text: "no link",
+				},
+			})
+			return
+		default:
+			h.logger.Error().Err(err).Msg("failed to revoke link")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	response := json.RawMessage([]byte(fmt.Sprintf(`{"%s": true}`, linkID)))
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Response: response,
+	})
+}
+
+// OpenLink serves document to anyone holding a valid link,
+// password comes in query or X-Link-Password header
+func (h handlers) OpenLink(w http.ResponseWriter, req *http.Request) {
+	if !h.allowAnonymous(w, req) {
+		return
+	}
+
+	err := req.ParseForm()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	linkID := req.PathValue("link")
+	if linkID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	expires, err := strconv.ParseInt(req.FormValue("expires"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeBadLink,
+				Text: "bad link",
+			},
+		})
+		return
+	}
+
+	password := req.Header.Get("X-Link-Password")
+	if password == "" {
+		password = req.FormValue("password")
+	}
+
+	meta, err := h.ctrl.OpenLink(req.Context(), linkID, expires, req.FormValue("sig"), password)
+	if err == nil && h.countsDownload(req, meta) {
+		err = h.ctrl.UseLink(req.Context(), linkID)
+	}
+	if err != nil {
+		switch err {
+		case docs.ErrBadLink:
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeBadLink,
+					Text: "bad link",
+				},
+			})
+			return
+		case docs.ErrExpired:
+			h.writeExpired(w)
+			return
+		case docs.ErrNoLink, docs.ErrNoDoc:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeNoLink,
+					Text: "no link",
+				},
+			})
+			return
+		case docs.ErrLinkExpired:
+			w.WriteHeader(http.StatusGone)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeLinkExpired,
+					Text: "link expired",
+				},
+			})
+			return
+		case docs.ErrLinkPassword:
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeLinkPassword,
+					Text: "wrong password",
+				},
+			})
+			return
+		default:
+			h.logger.Error().Err(err).Msg("failed to open link")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.Method == http.MethodHead {
+		h.writeMetaHeaders(w, req, meta)
+		return
+	}
+
+	h.writeContent(w, req, meta)
+}
+
+// countsDownload tells if request spends a download of link: full
+// content or a range from its start. Range continuations, HEAD and
+// requests answered 304 or 416 are not counted
+func (h handlers) countsDownload(req *http.Request, meta *docs.Meta) bool {
+	if req.Method == http.MethodHead {
+		return false
+	}
+
+	if match := req.Header.Get("If-None-Match"); match != "" && docs.MatchETag(match, meta.ETag(), true) {
+		return false
+	}
+
+	header := req.Header.Get("Range")
+	if !meta.File || header == "" || !h.rangeFresh(req, meta) {
+		return true
+	}
+
+	ranges, err := docs.ParseRange(header, meta.Size)
+	if err != nil {
+		return false
+	}
+	if ranges == nil {
+		return true
+	}
+	for _, r := range ranges {
+		if r.Start == 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+	"strconv"
+	"strings"
+	"net/url"
+	"encoding/json"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// listKeys are keys of key=value filters, pairs may repeat
+var listKeys = map[string]bool{
+	"name":    true,
+	"mime":    true,
+	"file":    true,
+	"public":  true,
+	"created": true,
+}
+
+// parseListQuery reads list filters, sort and cursor of form.
+// Errors wrap docs.ErrBadQuery, or are docs.ErrBadCursor
+func parseListQuery(form url.Values, q *docs.ListQuery) (err error) {
+	keys, values := form["key"], form["value"]
+	if len(keys) != len(values) {
+		return fmt.Errorf("%w: key and value must come in pairs", docs.ErrBadQuery)
+	}
+
+	filters := url.Values{}
+	for i, key := range keys {
+		if !listKeys[key] {
+			return fmt.Errorf("%w: bad key %q", docs.ErrBadQuery, key)
+		}
+		filters.Set(key, values[i])
+	}
+	for _, key := range []string{"name", "name_prefix", "mime", "file", "public", "created_after", "created_before", "min_size", "max_size"} {
+		if form.Has(key) {
+			filters.Set(key, form.Get(key))
+		}
+	}
+
+	if filters.Has("name") {
+		q.Name = ptr(filters.Get("name"))
+	}
+	if filters.Has("name_prefix") {
+		q.NamePrefix = ptr(filters.Get("name_prefix"))
+	}
+	if filters.Has("mime") {
+		q.Mime = ptr(filters.Get("mime"))
+	}
+	if q.File, err = parseOptional(filters, "file", strconv.ParseBool); err != nil {
+		return
+	}
+	if q.Public, err = parseOptional(filters, "public", strconv.ParseBool); err != nil {
+		return
+	}
+	if q.CreatedAfter, err = parseOptional(filters, "created_after", parseListTime); err != nil {
+		return
+	}
+	if q.CreatedBefore, err = parseOptional(filters, "created_before", parseListTime); err != nil {
+		return
+	}
+	if q.MinSize, err = parseOptional(filters, "min_size", parseSize); err != nil {
+		return
+	}
+	if q.MaxSize, err = parseOptional(filters, "max_size", parseSize); err != nil {
+		return
+	}
+
+	if form.Has("json_contains") {
+		q.JSONContains = json.RawMessage(form.Get("json_contains"))
+		if !json.Valid(q.JSONContains) {
+			return fmt.Errorf("%w: json_contains must be json", docs.ErrBadQuery)
+		}
+	}
+	if form.Has("json_path") {
+		q.JSONPath = ptr(form.Get("json_path"))
+	}
+	// empty parent_id lists documents at root
+	if form.Has("parent_id") {
+		q.ParentID = ptr(form.Get("parent_id"))
+	}
+
+	// tag may repeat, documents must have all of them, as all of meta.<key>
+	if tags := form["tag"]; len(tags) > 0 {
+		q.Tags = tags
+	}
+	for key, values := range form {
+		if name, ok := strings.CutPrefix(key, "meta."); ok {
+			if name == "" || len(values) != 1 {
+				return fmt.Errorf("%w: bad metadata filter %q", docs.ErrBadQuery, key)
+			}
+			if q.Metadata == nil {
+				q.Metadata = make(map[string]string, 0)
+			}
+			q.Metadata[name] = values[0]
+		}
+	}
+
+	// created=value is the second documents list shows
+	if filters.Has("created") {
+		created, err := parseListTime(filters.Get("created"))
+		if err != nil {
+			return fmt.Errorf("%w: bad created", docs.ErrBadQuery)
+		}
+		before := created.Add(time.Second)
+		q.CreatedAfter, q.CreatedBefore = &created, &before
+	}
+
+	q.Sort = docs.SortCreated
+	if form.Has("sort") {
+		q.Sort = form.Get("sort")
+		if !docs.ValidSort(q.Sort) {
+			return fmt.Errorf("%w: bad sort", docs.ErrBadQuery)
+		}
+	}
+
+	switch form.Get("order") {
+	case "", "desc":
+		q.Desc = true
+	case "asc":
+		q.Desc = false
+	default:
+		return fmt.Errorf("%w: order must be asc or desc", docs.ErrBadQuery)
+	}
+
+	if cursor := form.Get("cursor"); cursor != "" {
+		q.Cursor, err = docs.ParseCursor(cursor, q.Sort, q.Desc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseListTime accepts RFC 3339 and created format of documents,
+// which is server local time
+func parseListTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.ParseInLocation(time.DateTime, value, time.Local)
+	}
+	return t, nil
+}
+
+func parseSize(value string) (int64, error) {
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func parseOptional[T any](form url.Values, key string, parse func(string) (T, error)) (*T, error) {
+	if !form.Has(key) {
+		return nil, nil
+	}
+
+	value, err := parse(form.Get(key))
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad %s", docs.ErrBadQuery, key)
+	}
+
+	return &value, nil
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
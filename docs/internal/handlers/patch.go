@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"io"
+	"errors"
+	"net/http"
+	"encoding/json"
+	server "github.com/bd878/doc_server/pkg/model"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// Patch applies json patch or merge patch of body to json document,
+// token comes in query as body is the patch
+func (h handlers) Patch(w http.ResponseWriter, req *http.Request) {
+	token := req.URL.Query().Get("token")
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoToken,
+				Text: "no token",
+			},
+		})
+		return
+	}
+
+	login, err := h.gateway.Auth(req.Context(), token)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to auth")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoUser,
+				Text: "not authorized",
+			},
+		})
+		return
+	}
+
+	if login == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id := req.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	patch, err := io.ReadAll(&sizeLimitReader{r: req.Body, limit: h.maxJSONSize})
+	if err != nil {
+		if errors.Is(err, docs.ErrFileTooLarge) {
+			h.writeTooLarge(w)
+			return
+		}
+		h.logger.Error().Err(err).Msg("failed to read patch")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	kind := docs.BaseMime(req.Header.Get("Content-Type"))
+
+	meta, jsonData, err := h.ctrl.Patch(req.Context(), login, id, req.Header.Get("If-Match"), kind, patch)
+	if err != nil {
+		switch {
+		case err == docs.ErrExpired:
+			h.writeExpired(w)
+		case err == docs.ErrNoDoc:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeDocNotFound,
+					Text: "no document",
+				},
+			})
+		case err == docs.ErrForbidden:
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeForbidden,
+					Text: "forbidden",
+				},
+			})
+		case err == docs.ErrPrecondition:
+			w.WriteHeader(http.StatusPreconditionFailed)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodePrecondition,
+					Text: "document was changed",
+				},
+			})
+		case err == docs.ErrNotJSON:
+			w.Header().Set("Accept-Patch", docs.AcceptPatch)
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeNotJSON,
+					Text: "files can not be patched",
+				},
+			})
+		case errors.Is(err, docs.ErrFileTooLarge):
+			h.writeTooLarge(w)
+		case errors.Is(err, docs.ErrBadPatch):
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeBadPatch,
+					Text: err.Error(),
+				},
+			})
+		case errors.Is(err, docs.ErrPatchConflict):
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodePatchConflict,
+					Text: err.Error(),
+				},
+			})
+		default:
+			if h.writeSchemaError(w, err) {
+				return
+			}
+			h.logger.Error().Err(err).Msg("failed to patch doc")
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("ETag", meta.ETag())
+
+	response, err := json.Marshal(docs.SaveResponse{
+		ID:     id,
+		File:   meta.Name,
+		JSON:   json.RawMessage(jsonData),
+	})
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Data: json.RawMessage(response),
+	})
+}
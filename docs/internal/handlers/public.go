@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"net/http"
+	"encoding/json"
+	server "github.com/bd878/doc_server/pkg/model"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// publicMaxLimit caps pages of public list, larger limits are clamped
+const publicMaxLimit = 100
+
+// allowAnonymous rate limits requests without token by remote address
+func (h handlers) allowAnonymous(w http.ResponseWriter, req *http.Request) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	if h.limiter.Allow(host) {
+		return true
+	}
+
+	h.logger.Warn().Str("addr", host).Msg("anonymous rate limit exceeded")
+
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", int(h.limiter.RetryAfter().Seconds())+1))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Error: &server.ErrorCode{
+			Code: server.CodeTooManyRequests,
+			Text: "too many requests",
+		},
+	})
+	return false
+}
+
+func (h handlers) PublicGet(w http.ResponseWriter, req *http.Request) {
+	if !h.allowAnonymous(w, req) {
+		return
+	}
+
+	id := req.PathValue("id")
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if req.Method == http.MethodHead {
+		h.writeHead(w, req, id, "")
+		return
+	}
+
+	h.writeDoc(w, req, id, "")
+}
+
+func (h handlers) PublicList(w http.ResponseWriter, req *http.Request) {
+	if !h.allowAnonymous(w, req) {
+		return
+	}
+
+	err := req.ParseForm()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	owner := req.FormValue("owner")
+	if owner == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeNoOwner,
+				Text: "no owner",
+			},
+		})
+		return
+	}
+
+	rawLimit := req.FormValue("limit")
+	if rawLimit == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeNoLimit,
+				Text: "no limit",
+			},
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(rawLimit)
+	if err != nil || limit < 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeBadLimit,
+				Text: "bad limit param",
+			},
+		})
+		return
+	}
+
+	limit = min(limit, publicMaxLimit)
+
+	list, err := h.ctrl.ListPublic(req.Context(), owner, limit)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to list public docs")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response, err := json.Marshal(docs.ListResponse{
+		Docs: list,
+	})
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Data: json.RawMessage(response),
+	})
+}
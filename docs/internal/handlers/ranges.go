@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"mime/multipart"
+	"encoding/json"
+	server "github.com/bd878/doc_server/pkg/model"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// rangeFresh tells if Range applies to current content.
+// If-Range with other etag or a date asks for the whole document
+func (h handlers) rangeFresh(req *http.Request, meta *docs.Meta) bool {
+	ifRange := req.Header.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	return docs.MatchETag(ifRange, meta.ETag(), false)
+}
+
+// writeRanges sends parts of file Range asks for, false tells
+// nothing is written and the whole file is to be sent instead
+func (h handlers) writeRanges(w http.ResponseWriter, req *http.Request, meta *docs.Meta, header string) bool {
+	ranges, err := docs.ParseRange(header, meta.Size)
+	if err == nil && ranges == nil {
+		return false
+	}
+
+	h.writeDigest(w, meta.SHA256, false)
+
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", meta.Size))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeBadRange,
+				Text: "range not satisfiable",
+			},
+		})
+		return true
+	}
+
+	if len(ranges) == 1 {
+		r := ranges[0]
+
+		w.Header().Set("Content-Type", meta.ContentType())
+		w.Header().Set("Content-Range", r.ContentRange(meta.Size))
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", r.Length))
+		w.WriteHeader(http.StatusPartialContent)
+
+		err = h.ctrl.ReadFileRange(req.Context(), meta.Blob, r.Start, r.Length, w)
+		if err != nil {
+			h.logger.Error().Err(err).Msg("failed to read file range")
+		}
+		return true
+	}
+
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary=" + mw.Boundary())
+	w.WriteHeader(http.StatusPartialContent)
+
+	for _, r := range ranges {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {meta.ContentType()},
+			"Content-Range": {r.ContentRange(meta.Size)},
+		})
+		if err != nil {
+			h.logger.Error().Err(err).Msg("failed to create range part")
+			return true
+		}
+
+		err = h.ctrl.ReadFileRange(req.Context(), meta.Blob, r.Start, r.Length, part)
+		if err != nil {
+			h.logger.Error().Err(err).Msg("failed to read file range")
+			return true
+		}
+	}
+
+	mw.Close()
+	return true
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"net/http"
+	"encoding/json"
+	server "github.com/bd878/doc_server/pkg/model"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// authToken authenticates login by token form value
+func (h handlers) authToken(w http.ResponseWriter, req *http.Request) (owner string, ok bool) {
+	token := req.FormValue("token")
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoToken,
+				Text: "no token",
+			},
+		})
+		return "", false
+	}
+
+	owner, err := h.gateway.Auth(req.Context(), token)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to auth")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoUser,
+				Text: "not authorized",
+			},
+		})
+		return "", false
+	}
+
+	if owner == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return "", false
+	}
+
+	return owner, true
+}
+
+func (h handlers) SaveSchema(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseMultipartForm(1 << 20 /* 1 MB */)
+	if err != nil && err != http.ErrNotMultipart {
+		h.logger.Error().Err(err).Msg("failed to parse form")
+
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoForm,
+				Text: "failed to parse form",
+			},
+		})
+		return
+	}
+
+	owner, ok := h.authToken(w, req)
+	if !ok {
+		return
+	}
+
+	schema := &docs.Schema{
+		Name:    req.PathValue("name"),
+		Owner:   owner,
+		Schema:  json.RawMessage(req.FormValue("schema")),
+	}
+
+	if schema.Name == "" || len(schema.Name) > 256 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if rawDefault := req.FormValue("default"); rawDefault != "" {
+		schema.Default, err = strconv.ParseBool(rawDefault)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeBadSchema,
+					Text: "default must be true or false",
+				},
+			})
+			return
+		}
+	}
+
+	err = h.ctrl.SaveSchema(req.Context(), schema)
+	if err != nil {
+		if errors.Is(err, docs.ErrBadSchema) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeBadSchema,
+					Text: err.Error(),
+				},
+			})
+			return
+		}
+		h.logger.Error().Err(err).Msg("failed to save schema")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.writeSchema(w, schema)
+}
+
+func (h handlers) GetSchema(w http.ResponseWriter, req *http.Request) {
+	owner, ok := h.authToken(w, req)
+	if !ok {
+		return
+	}
+
+	schema, err := h.ctrl.GetSchema(req.Context(), owner, req.PathValue("name"))
+	if err != nil {
+		if err == docs.ErrNoSchema {
+			h.writeNoSchema(w, http.StatusNotFound)
+			return
+		}
+		h.logger.Error().Err(err).Msg("failed to get schema")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.writeSchema(w, schema)
+}
+
+func (h handlers) ListSchemas(w http.ResponseWriter, req *http.Request) {
+	owner, ok := h.authToken(w, req)
+	if !ok {
+		return
+	}
+
+	schemas, err := h.ctrl.ListSchemas(req.Context(), owner)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to list schemas")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response, err := json.Marshal(docs.SchemasResponse{
+		Schemas: schemas,
+	})
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Data: json.RawMessage(response),
+	})
+}
+
+func (h handlers) DeleteSchema(w http.ResponseWriter, req *http.Request) {
+	owner, ok := h.authToken(w, req)
+	if !ok {
+		return
+	}
+
+	err := h.ctrl.DeleteSchema(req.Context(), owner, req.PathValue("name"))
+	if err != nil {
+		switch err {
+		case docs.ErrNoSchema:
+			h.writeNoSchema(w, http.StatusNotFound)
+		case docs.ErrSchemaInUse:
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeSchemaInUse,
+					Text: "documents use schema",
+				},
+			})
+		default:
+			h.logger.Error().Err(err).Msg("failed to delete schema")
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h handlers) writeSchema(w http.ResponseWriter, schema *docs.Schema) {
+	response, err := json.Marshal(schema)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Data: json.RawMessage(response),
+	})
+}
+
+func (h handlers) writeNoSchema(w http.ResponseWriter, status int) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Error: &server.ErrorCode{
+			Code: docs.CodeNoSchema,
+			Text: "no schema",
+		},
+	})
+}
+
+// writeSchemaError writes errors of checking json against schema,
+// violations go to details. False if err is none of them
+func (h handlers) writeSchemaError(w http.ResponseWriter, err error) bool {
+	var schemaErr *docs.SchemaError
+
+	switch {
+	case errors.As(err, &schemaErr):
+		details := make([]server.ErrorDetail, len(schemaErr.Violations))
+		for i, v := range schemaErr.Violations {
+			details[i] = server.ErrorDetail{Path: v.Path, Reason: v.Keyword, Text: v.Text}
+		}
+
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code:    docs.CodeSchemaViolation,
+				Text:    "json does not match schema " + schemaErr.Schema,
+				Details: details,
+			},
+		})
+	case err == docs.ErrNoSchema:
+		h.writeNoSchema(w, http.StatusBadRequest)
+	case err == docs.ErrNotJSON:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeNotJSON,
+				Text: "schema applies to json documents only",
+			},
+		})
+	default:
+		return false
+	}
+
+	return true
+}
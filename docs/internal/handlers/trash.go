@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+	"encoding/json"
+	server "github.com/bd878/doc_server/pkg/model"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// ListTrash lists deleted documents login may restore
+func (h handlers) ListTrash(w http.ResponseWriter, req *http.Request) {
+	login, ok := h.authToken(w, req)
+	if !ok {
+		return
+	}
+
+	list, err := h.ctrl.ListTrash(req.Context(), login)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to list trash")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response, err := json.Marshal(docs.ListResponse{
+		Docs: list,
+	})
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Data: json.RawMessage(response),
+	})
+}
+
+func (h handlers) RestoreTrash(w http.ResponseWriter, req *http.Request) {
+	login, ok := h.authToken(w, req)
+	if !ok {
+		return
+	}
+
+	meta, err := h.ctrl.RestoreTrash(req.Context(), login, req.PathValue("id"))
+	if err != nil {
+		switch err {
+		case docs.ErrNoDoc:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeDocNotFound,
+					Text: "no document in trash",
+				},
+			})
+		case docs.ErrForbidden:
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(server.ServerResponse{
+				Error: &server.ErrorCode{
+					Code: docs.CodeForbidden,
+					Text: "forbidden",
+				},
+			})
+		case docs.ErrExpired:
+			h.writeExpired(w)
+		case docs.ErrMimeDenied:
+			h.writeMimeDenied(w)
+		default:
+			h.logger.Error().Err(err).Msg("failed to restore from trash")
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("ETag", meta.ETag())
+
+	response, err := json.Marshal(meta)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to marshal response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Data: json.RawMessage(response),
+	})
+}
@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+	"strings"
+	"strconv"
+	"net/http"
+	"encoding/json"
+	"encoding/base64"
+	server "github.com/bd878/doc_server/pkg/model"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// tus resumable upload protocol, https://tus.io/protocols/resumable-upload
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,creation-with-upload,expiration,termination"
+	tusChunkType  = "application/offset+octet-stream"
+)
+
+// tusResumable sets protocol headers and checks client speaks same version
+func (h handlers) tusResumable(w http.ResponseWriter, req *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if req.Header.Get("Tus-Resumable") == tusVersion {
+		return true
+	}
+
+	w.Header().Set("Tus-Version", tusVersion)
+	w.WriteHeader(http.StatusPreconditionFailed)
+	json.NewEncoder(w).Encode(server.ServerResponse{
+		Error: &server.ErrorCode{
+			Code: docs.CodeBadUpload,
+			Text: "unsupported tus version",
+		},
+	})
+	return false
+}
+
+// authUpload authenticates by query token, upload body is not a form
+func (h handlers) authUpload(w http.ResponseWriter, req *http.Request) (login string, ok bool) {
+	token := req.URL.Query().Get("token")
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoToken,
+				Text: "no token",
+			},
+		})
+		return "", false
+	}
+
+	login, err := h.gateway.Auth(req.Context(), token)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to auth")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: server.CodeNoUser,
+				Text: "not authorized",
+			},
+		})
+		return "", false
+	}
+
+	if login == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return "", false
+	}
+
+	return login, true
+}
+
+func (h handlers) UploadOptions(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	if h.uploadMaxSize > 0 {
+		w.Header().Set("Tus-Max-Size", fmt.Sprintf("%d", h.uploadMaxSize))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h handlers) CreateUpload(w http.ResponseWriter, req *http.Request) {
+	if !h.tusResumable(w, req) {
+		return
+	}
+
+	login, ok := h.authUpload(w, req)
+	if !ok {
+		return
+	}
+
+	length, err := strconv.ParseInt(req.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeBadUpload,
+				Text: "Upload-Length required",
+			},
+		})
+		return
+	}
+
+	if h.uploadMaxSize > 0 && length > h.uploadMaxSize {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeUploadLength,
+				Text: "upload too large",
+			},
+		})
+		return
+	}
+
+	metadata, err := parseUploadMetadata(req.Header.Get("Upload-Metadata"))
+	if err != nil || metadata["filename"] == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeBadUpload,
+				Text: "Upload-Metadata with filename required",
+			},
+		})
+		return
+	}
+
+	mime := metadata["filetype"]
+	if mime == "" {
+		mime = "application/octet-stream"
+	}
+
+	upload := &docs.Upload{
+		Owner:    login,
+		Name:     metadata["filename"],
+		Mime:     mime,
+		Public:   metadata["public"] == "true",
+		Length:   length,
+		ParentID: metadata["parent_id"],
+	}
+
+	if !h.readUploadDoc(w, metadata, upload) {
+		return
+	}
+
+	meta, err := h.ctrl.CreateUpload(req.Context(), upload)
+	if err == docs.ErrMimeDenied {
+		h.writeMimeDenied(w)
+		return
+	}
+	if err == docs.ErrNoFolder {
+		h.writeNoFolder(w, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("failed to create upload")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/api/uploads/" + upload.ID)
+	w.Header().Set("Upload-Expires", time.Unix(upload.ExpiresTs, 0).UTC().Format(http.TimeFormat))
+
+	// creation-with-upload, first chunk comes in creation request
+	if meta == nil && req.Header.Get("Content-Type") == tusChunkType {
+		upload, meta, err = h.ctrl.WriteUpload(req.Context(), login, upload.ID, 0, req.Body)
+		if err != nil {
+			h.writeUploadError(w, err)
+			return
+		}
+	}
+
+	h.writeUploadHeaders(w, upload, meta)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h handlers) GetUploadOffset(w http.ResponseWriter, req *http.Request) {
+	if !h.tusResumable(w, req) {
+		return
+	}
+
+	login, ok := h.authUpload(w, req)
+	if !ok {
+		return
+	}
+
+	upload, err := h.ctrl.GetUpload(req.Context(), login, req.PathValue("id"))
+	if err != nil {
+		h.writeUploadError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Length", fmt.Sprintf("%d", upload.Length))
+	w.Header().Set("Upload-Expires", time.Unix(upload.ExpiresTs, 0).UTC().Format(http.TimeFormat))
+	h.writeUploadHeaders(w, upload, nil)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h handlers) WriteUpload(w http.ResponseWriter, req *http.Request) {
+	if !h.tusResumable(w, req) {
+		return
+	}
+
+	login, ok := h.authUpload(w, req)
+	if !ok {
+		return
+	}
+
+	if req.Header.Get("Content-Type") != tusChunkType {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeBadUpload,
+				Text: "Content-Type must be " + tusChunkType,
+			},
+		})
+		return
+	}
+
+	offset, err := strconv.ParseInt(req.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeBadUpload,
+				Text: "Upload-Offset required",
+			},
+		})
+		return
+	}
+
+	upload, meta, err := h.ctrl.WriteUpload(req.Context(), login, req.PathValue("id"), offset, req.Body)
+	if err != nil {
+		h.writeUploadError(w, err)
+		return
+	}
+
+	h.writeUploadHeaders(w, upload, meta)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h handlers) DeleteUpload(w http.ResponseWriter, req *http.Request) {
+	if !h.tusResumable(w, req) {
+		return
+	}
+
+	login, ok := h.authUpload(w, req)
+	if !ok {
+		return
+	}
+
+	err := h.ctrl.DeleteUpload(req.Context(), login, req.PathValue("id"))
+	if err != nil {
+		h.writeUploadError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readUploadDoc reads fields of the document upload becomes, as form
+// meta has them: tags is json array, metadata json object, expires_at
+// RFC 3339 time. Uploads make files, json schema does not apply to them
+func (h handlers) readUploadDoc(w http.ResponseWriter, metadata map[string]string, upload *docs.Upload) bool {
+	if metadata["schema"] != "" {
+		h.writeSchemaError(w, docs.ErrNotJSON)
+		return false
+	}
+
+	var err error
+	if value, ok := metadata["tags"]; ok {
+		err = json.Unmarshal([]byte(value), &upload.Tags)
+	}
+	if value, ok := metadata["metadata"]; ok && err == nil {
+		err = json.Unmarshal([]byte(value), &upload.Metadata)
+	}
+	if err != nil {
+		h.writeBadMetadata(w, fmt.Errorf("%w: tags must be json array, metadata json object", docs.ErrBadMetadata))
+		return false
+	}
+
+	upload.Tags, err = docs.CleanTags(upload.Tags)
+	if err == nil {
+		err = docs.CheckMetadata(upload.Metadata)
+	}
+	if err != nil {
+		h.writeBadMetadata(w, err)
+		return false
+	}
+
+	expires, ok := h.readExpiry(w, metadata["expires_at"])
+	if !ok {
+		return false
+	}
+	if !expires.IsZero() {
+		upload.DocExpiresTs = expires.Unix()
+	}
+
+	return true
+}
+
+// writeUploadHeaders reports offset, and document once upload is complete
+func (h handlers) writeUploadHeaders(w http.ResponseWriter, upload *docs.Upload, meta *docs.Meta) {
+	w.Header().Set("Upload-Offset", fmt.Sprintf("%d", upload.Offset))
+	if meta != nil {
+		w.Header().Set("Content-Location", "/api/docs/" + meta.ID)
+		w.Header().Set("ETag", meta.ETag())
+		h.writeDigest(w, meta.SHA256, false)
+	}
+}
+
+func (h handlers) writeUploadError(w http.ResponseWriter, err error) {
+	switch err {
+	case docs.ErrNoUpload:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeNoUpload,
+				Text: "no upload",
+			},
+		})
+	case docs.ErrUploadOffset:
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeUploadOffset,
+				Text: "Upload-Offset does not match",
+			},
+		})
+	case docs.ErrUploadLength:
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(server.ServerResponse{
+			Error: &server.ErrorCode{
+				Code: docs.CodeUploadLength,
+				Text: "chunk exceeds Upload-Length",
+			},
+		})
+	case docs.ErrMimeDenied:
+		h.writeMimeDenied(w)
+	default:
+		h.logger.Error().Err(err).Msg("failed to upload")
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// parseUploadMetadata decodes comma separated "key base64value" pairs,
+// value may be omitted
+func parseUploadMetadata(header string) (metadata map[string]string, err error) {
+	metadata = make(map[string]string)
+
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, encoded, _ := strings.Cut(pair, " ")
+
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+
+		metadata[key] = string(value)
+	}
+
+	return
+}
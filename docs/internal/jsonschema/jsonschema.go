@@ -0,0 +1,858 @@
+// Package jsonschema validates json documents against a subset of
+// JSON Schema draft 2020-12. References are local to the schema,
+// patterns are RE2 rather than ECMA 262 expressions
+package jsonschema
+
+import (
+	"fmt"
+	"sort"
+	"bytes"
+	"regexp"
+	"strings"
+	"math/big"
+	"unicode/utf8"
+	"encoding/json"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// Dialect is the only $schema value accepted
+const Dialect = "https://json-schema.org/draft/2020-12/schema"
+
+// maxViolations bounds violations reported of one document
+const maxViolations = 100
+
+// maxDepth bounds nesting of subschemas and references
+const maxDepth = 64
+
+// maxSteps bounds subschemas applied validating one document
+const maxSteps = 1 << 20
+
+type Schema struct {
+	root      interface{}
+	patterns  map[string]*regexp.Regexp
+	refs      map[string]bool // checked reference targets
+	steps     int // subschemas applied by validation running
+}
+
+// Compile checks schema is one validator supports.
+// Errors wrap docs.ErrBadSchema
+func Compile(raw []byte) (schema *Schema, err error) {
+	root, err := decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", docs.ErrBadSchema, err)
+	}
+
+	schema = &Schema{root: root, patterns: make(map[string]*regexp.Regexp), refs: map[string]bool{"#": true}}
+
+	if fields, ok := root.(map[string]interface{}); ok {
+		if dialect, ok := fields["$schema"]; ok && dialect != Dialect {
+			return nil, fmt.Errorf("%w: $schema must be %s", docs.ErrBadSchema, Dialect)
+		}
+	}
+
+	err = schema.check(root, "#", true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", docs.ErrBadSchema, err)
+	}
+
+	err = schema.checkCycles()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", docs.ErrBadSchema, err)
+	}
+
+	return schema, nil
+}
+
+// Validate lists places of document which fail schema, none if it is valid
+func (s *Schema) Validate(document []byte) (violations []docs.Violation, err error) {
+	value, err := decode(document)
+	if err != nil {
+		return nil, err
+	}
+
+	// copy counts steps of this validation only
+	run := *s
+	run.steps = 0
+
+	violations = run.validate(s.root, value, "", 0)
+	if run.steps > maxSteps {
+		// results of stopped validation are partial, anyOf or not may pass wrongly
+		return []docs.Violation{{Keyword: "$schema", Text: "schema takes too many steps to validate"}}, nil
+	}
+	if len(violations) > maxViolations {
+		violations = violations[:maxViolations]
+	}
+
+	return violations, nil
+}
+
+// decode keeps numbers exact, as written
+func decode(data []byte) (value interface{}, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err = decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("trailing data after json")
+	}
+	return value, nil
+}
+
+// keyword kinds tell what values of keywords must be
+type kind int
+
+const (
+	kindAny kind = iota
+	kindSchema
+	kindSchemas
+	kindSchemaMap
+	kindNumber
+	kindPositive
+	kindCount
+	kindType
+	kindArray
+	kindStrings
+	kindStringsMap
+	kindPattern
+	kindPatternMap
+	kindRef
+	kindString
+)
+
+var keywords = map[string]kind{
+	"$schema":              kindString,
+	"$id":                  kindString,
+	"$comment":             kindString,
+	"$defs":                kindSchemaMap,
+	"$ref":                 kindRef,
+	"type":                 kindType,
+	"enum":                 kindArray,
+	"const":                kindAny,
+	"multipleOf":           kindPositive,
+	"maximum":              kindNumber,
+	"exclusiveMaximum":     kindNumber,
+	"minimum":              kindNumber,
+	"exclusiveMinimum":     kindNumber,
+	"maxLength":            kindCount,
+	"minLength":            kindCount,
+	"pattern":              kindPattern,
+	"prefixItems":          kindSchemas,
+	"items":                kindSchema,
+	"contains":             kindSchema,
+	"maxContains":          kindCount,
+	"minContains":          kindCount,
+	"maxItems":             kindCount,
+	"minItems":             kindCount,
+	"uniqueItems":          kindAny,
+	"properties":           kindSchemaMap,
+	"patternProperties":    kindPatternMap,
+	"additionalProperties": kindSchema,
+	"propertyNames":        kindSchema,
+	"maxProperties":        kindCount,
+	"minProperties":        kindCount,
+	"required":             kindStrings,
+	"dependentRequired":    kindStringsMap,
+	"dependentSchemas":     kindSchemaMap,
+	"allOf":                kindSchemas,
+	"anyOf":                kindSchemas,
+	"oneOf":                kindSchemas,
+	"not":                  kindSchema,
+	"if":                   kindSchema,
+	"then":                 kindSchema,
+	"else":                 kindSchema,
+}
+
+// unsupported keywords change validation in ways validator does not
+// follow, schemas using them are rejected rather than half applied
+var unsupported = map[string]bool{
+	"unevaluatedItems":      true,
+	"unevaluatedProperties": true,
+	"$dynamicRef":           true,
+	"$dynamicAnchor":        true,
+	"$recursiveRef":         true,
+	"$recursiveAnchor":      true,
+	"$anchor":               true,
+}
+
+var types = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true,
+	"number": true, "string": true, "integer": true,
+}
+
+// check walks schema at location, annotations as title or format
+// and unknown keywords are allowed and ignored
+func (s *Schema) check(schema interface{}, location string, root bool) error {
+	if _, ok := schema.(bool); ok {
+		return nil
+	}
+
+	fields, ok := schema.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s: schema must be object or boolean", location)
+	}
+
+	for keyword, value := range fields {
+		at := location + "/" + keyword
+
+		if unsupported[keyword] {
+			return fmt.Errorf("%s: %s is not supported", at, keyword)
+		}
+		if keyword == "$id" && !root {
+			return fmt.Errorf("%s: $id is allowed at root only", at)
+		}
+
+		switch keywords[keyword] {
+		case kindSchema:
+			if err := s.check(value, at, false); err != nil {
+				return err
+			}
+		case kindSchemas:
+			items, ok := value.([]interface{})
+			if !ok || len(items) == 0 {
+				return fmt.Errorf("%s: must be non empty array of schemas", at)
+			}
+			for i, item := range items {
+				if err := s.check(item, fmt.Sprintf("%s/%d", at, i), false); err != nil {
+					return err
+				}
+			}
+		case kindSchemaMap, kindPatternMap:
+			members, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s: must be object of schemas", at)
+			}
+			for name, member := range members {
+				if keywords[keyword] == kindPatternMap {
+					if err := s.compilePattern(name, at); err != nil {
+						return err
+					}
+				}
+				if err := s.check(member, at + "/" + escape(name), false); err != nil {
+					return err
+				}
+			}
+		case kindNumber, kindPositive:
+			n, ok := number(value)
+			if !ok || (keywords[keyword] == kindPositive && n.Sign() <= 0) {
+				return fmt.Errorf("%s: must be a number", at)
+			}
+		case kindCount:
+			n, ok := number(value)
+			if !ok || !n.IsInt() || n.Sign() < 0 {
+				return fmt.Errorf("%s: must be non negative integer", at)
+			}
+		case kindType:
+			names, ok := value.([]interface{})
+			if !ok {
+				names = []interface{}{value}
+			}
+			for _, name := range names {
+				if typ, ok := name.(string); !ok || !types[typ] {
+					return fmt.Errorf("%s: unknown type %v", at, name)
+				}
+			}
+		case kindArray:
+			if _, ok := value.([]interface{}); !ok {
+				return fmt.Errorf("%s: must be array", at)
+			}
+		case kindStrings:
+			if !isStrings(value) {
+				return fmt.Errorf("%s: must be array of strings", at)
+			}
+		case kindStringsMap:
+			members, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s: must be object of string arrays", at)
+			}
+			for _, member := range members {
+				if !isStrings(member) {
+					return fmt.Errorf("%s: must be object of string arrays", at)
+				}
+			}
+		case kindPattern:
+			pattern, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%s: must be string", at)
+			}
+			if err := s.compilePattern(pattern, at); err != nil {
+				return err
+			}
+		case kindRef:
+			ref, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%s: must be string", at)
+			}
+			target, err := s.resolve(ref)
+			if err != nil {
+				return fmt.Errorf("%s: %v", at, err)
+			}
+			// targets outside of keywords walked are checked once
+			if !s.refs[ref] {
+				s.refs[ref] = true
+				if err := s.check(target, ref, false); err != nil {
+					return err
+				}
+			}
+		case kindString:
+			if _, ok := value.(string); !ok {
+				return fmt.Errorf("%s: must be string", at)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkCycles rejects references leading back to themselves without
+// moving into the instance, as {"allOf":[{"$ref":"#"}]}, such schema
+// would apply to the same value endlessly
+func (s *Schema) checkCycles() error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := make(map[string]int)
+
+	var visit func(ref string) error
+	visit = func(ref string) error {
+		switch state[ref] {
+		case visiting:
+			return fmt.Errorf("%s: refers to itself on the same value", ref)
+		case visited:
+			return nil
+		}
+
+		state[ref] = visiting
+		target, _ := s.resolve(ref)
+		for _, next := range inPlaceRefs(target) {
+			if err := visit(next); err != nil {
+				return err
+			}
+		}
+		state[ref] = visited
+
+		return nil
+	}
+
+	refs := make([]string, 0, len(s.refs))
+	for ref := range s.refs {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	for _, ref := range refs {
+		if err := visit(ref); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// inPlaceRefs lists references schema applies to the value itself,
+// keywords as items or properties move into the value and are skipped
+func inPlaceRefs(schema interface{}) (refs []string) {
+	fields, ok := schema.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	if ref, ok := fields["$ref"].(string); ok {
+		refs = append(refs, ref)
+	}
+
+	for _, keyword := range []string{"not", "if", "then", "else"} {
+		refs = append(refs, inPlaceRefs(fields[keyword])...)
+	}
+
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		items, _ := fields[keyword].([]interface{})
+		for _, item := range items {
+			refs = append(refs, inPlaceRefs(item)...)
+		}
+	}
+
+	dependent, _ := fields["dependentSchemas"].(map[string]interface{})
+	for _, name := range sortedKeys(dependent) {
+		refs = append(refs, inPlaceRefs(dependent[name])...)
+	}
+
+	return refs
+}
+
+func (s *Schema) compilePattern(pattern, location string) error {
+	if _, ok := s.patterns[pattern]; ok {
+		return nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("%s: bad pattern %q", location, pattern)
+	}
+
+	s.patterns[pattern] = re
+	return nil
+}
+
+// resolve finds subschema ref points at, only json pointers
+// into the schema itself, as #/$defs/name, are supported
+func (s *Schema) resolve(ref string) (interface{}, error) {
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("only local references are supported, got %q", ref)
+	}
+
+	node := s.root
+	if ref == "#" {
+		return node, nil
+	}
+
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+
+		switch v := node.(type) {
+		case map[string]interface{}:
+			next, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("no %q to refer to", ref)
+			}
+			node = next
+		case []interface{}:
+			var i int
+			if _, err := fmt.Sscanf(token, "%d", &i); err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("no %q to refer to", ref)
+			}
+			node = v[i]
+		default:
+			return nil, fmt.Errorf("no %q to refer to", ref)
+		}
+	}
+
+	switch node.(type) {
+	case bool, map[string]interface{}:
+		return node, nil
+	}
+	return nil, fmt.Errorf("%q is not a schema", ref)
+}
+
+func (s *Schema) validate(schema, value interface{}, path string, depth int) (violations []docs.Violation) {
+	fail := func(keyword, format string, args ...interface{}) {
+		violations = append(violations, docs.Violation{
+			Path:     path,
+			Keyword:  keyword,
+			Text:     fmt.Sprintf(format, args...),
+		})
+	}
+
+	if depth > maxDepth {
+		fail("$ref", "schema nests too deep")
+		return
+	}
+
+	s.steps++
+	if s.steps > maxSteps {
+		return
+	}
+
+	if allowed, ok := schema.(bool); ok {
+		if !allowed {
+			fail("false", "no value is allowed")
+		}
+		return
+	}
+
+	fields := schema.(map[string]interface{})
+
+	if ref, ok := fields["$ref"].(string); ok {
+		target, _ := s.resolve(ref)
+		violations = append(violations, s.validate(target, value, path, depth + 1)...)
+	}
+
+	if typ, ok := fields["type"]; ok && !matchType(typ, value) {
+		fail("type", "must be %s", typeNames(typ))
+	}
+
+	if enum, ok := fields["enum"].([]interface{}); ok {
+		found := false
+		for _, item := range enum {
+			if equal(item, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("enum", "must be one of allowed values")
+		}
+	}
+
+	if constant, ok := fields["const"]; ok && !equal(constant, value) {
+		fail("const", "must be %s", show(constant))
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		violations = append(violations, s.validateNumber(fields, v, path)...)
+	case string:
+		violations = append(violations, s.validateString(fields, v, path)...)
+	case []interface{}:
+		violations = append(violations, s.validateArray(fields, v, path, depth)...)
+	case map[string]interface{}:
+		violations = append(violations, s.validateObject(fields, v, path, depth)...)
+	}
+
+	if all, ok := fields["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			violations = append(violations, s.validate(sub, value, path, depth + 1)...)
+		}
+	}
+
+	if some, ok := fields["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range some {
+			if len(s.validate(sub, value, path, depth + 1)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("anyOf", "must match at least one schema of anyOf")
+		}
+	}
+
+	if one, ok := fields["oneOf"].([]interface{}); ok {
+		matched := 0
+		for _, sub := range one {
+			if len(s.validate(sub, value, path, depth + 1)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			fail("oneOf", "must match exactly one schema of oneOf, matches %d", matched)
+		}
+	}
+
+	if not, ok := fields["not"]; ok && len(s.validate(not, value, path, depth + 1)) == 0 {
+		fail("not", "must not match schema of not")
+	}
+
+	if cond, ok := fields["if"]; ok {
+		branch := "else"
+		if len(s.validate(cond, value, path, depth + 1)) == 0 {
+			branch = "then"
+		}
+		if sub, ok := fields[branch]; ok {
+			violations = append(violations, s.validate(sub, value, path, depth + 1)...)
+		}
+	}
+
+	return
+}
+
+func (s *Schema) validateNumber(fields map[string]interface{}, value json.Number, path string) (violations []docs.Violation) {
+	n, ok := number(value)
+	if !ok {
+		return
+	}
+
+	limit := func(keyword string, pass func(c int) bool, relation string) {
+		bound, ok := number(fields[keyword])
+		if ok && !pass(n.Cmp(bound)) {
+			violations = append(violations, docs.Violation{Path: path, Keyword: keyword, Text: fmt.Sprintf("must be %s %s", relation, bound.RatString())})
+		}
+	}
+	limit("minimum", func(c int) bool { return c >= 0 }, ">=")
+	limit("maximum", func(c int) bool { return c <= 0 }, "<=")
+	limit("exclusiveMinimum", func(c int) bool { return c > 0 }, ">")
+	limit("exclusiveMaximum", func(c int) bool { return c < 0 }, "<")
+
+	if divisor, ok := number(fields["multipleOf"]); ok && divisor.Sign() > 0 {
+		if !new(big.Rat).Quo(n, divisor).IsInt() {
+			violations = append(violations, docs.Violation{Path: path, Keyword: "multipleOf", Text: fmt.Sprintf("must be multiple of %s", divisor.RatString())})
+		}
+	}
+
+	return
+}
+
+func (s *Schema) validateString(fields map[string]interface{}, value string, path string) (violations []docs.Violation) {
+	length := utf8.RuneCountInString(value)
+
+	if min, ok := count(fields["minLength"]); ok && length < min {
+		violations = append(violations, docs.Violation{Path: path, Keyword: "minLength", Text: fmt.Sprintf("must be at least %d characters", min)})
+	}
+	if max, ok := count(fields["maxLength"]); ok && length > max {
+		violations = append(violations, docs.Violation{Path: path, Keyword: "maxLength", Text: fmt.Sprintf("must be at most %d characters", max)})
+	}
+	if pattern, ok := fields["pattern"].(string); ok && !s.patterns[pattern].MatchString(value) {
+		violations = append(violations, docs.Violation{Path: path, Keyword: "pattern", Text: fmt.Sprintf("must match %s", pattern)})
+	}
+
+	return
+}
+
+func (s *Schema) validateArray(fields map[string]interface{}, value []interface{}, path string, depth int) (violations []docs.Violation) {
+	if min, ok := count(fields["minItems"]); ok && len(value) < min {
+		violations = append(violations, docs.Violation{Path: path, Keyword: "minItems", Text: fmt.Sprintf("must have at least %d items", min)})
+	}
+	if max, ok := count(fields["maxItems"]); ok && len(value) > max {
+		violations = append(violations, docs.Violation{Path: path, Keyword: "maxItems", Text: fmt.Sprintf("must have at most %d items", max)})
+	}
+
+	if unique, ok := fields["uniqueItems"].(bool); ok && unique {
+	dups:
+		for i := range value {
+			for j := i + 1; j < len(value); j++ {
+				if equal(value[i], value[j]) {
+					violations = append(violations, docs.Violation{Path: path, Keyword: "uniqueItems", Text: fmt.Sprintf("items %d and %d are equal", i, j)})
+					break dups
+				}
+			}
+		}
+	}
+
+	prefix, _ := fields["prefixItems"].([]interface{})
+	for i, item := range value {
+		at := fmt.Sprintf("%s/%d", path, i)
+		if i < len(prefix) {
+			violations = append(violations, s.validate(prefix[i], item, at, depth + 1)...)
+		} else if items, ok := fields["items"]; ok {
+			violations = append(violations, s.validate(items, item, at, depth + 1)...)
+		}
+	}
+
+	if contains, ok := fields["contains"]; ok {
+		matched := 0
+		for _, item := range value {
+			if len(s.validate(contains, item, path, depth + 1)) == 0 {
+				matched++
+			}
+		}
+
+		min, ok := count(fields["minContains"])
+		if !ok {
+			min = 1
+		}
+		if matched < min {
+			violations = append(violations, docs.Violation{Path: path, Keyword: "contains", Text: fmt.Sprintf("must contain at least %d matching items", min)})
+		}
+		if max, ok := count(fields["maxContains"]); ok && matched > max {
+			violations = append(violations, docs.Violation{Path: path, Keyword: "maxContains", Text: fmt.Sprintf("must contain at most %d matching items", max)})
+		}
+	}
+
+	return
+}
+
+func (s *Schema) validateObject(fields map[string]interface{}, value map[string]interface{}, path string, depth int) (violations []docs.Violation) {
+	if min, ok := count(fields["minProperties"]); ok && len(value) < min {
+		violations = append(violations, docs.Violation{Path: path, Keyword: "minProperties", Text: fmt.Sprintf("must have at least %d properties", min)})
+	}
+	if max, ok := count(fields["maxProperties"]); ok && len(value) > max {
+		violations = append(violations, docs.Violation{Path: path, Keyword: "maxProperties", Text: fmt.Sprintf("must have at most %d properties", max)})
+	}
+
+	if required, ok := fields["required"].([]interface{}); ok {
+		for _, name := range required {
+			if _, ok := value[name.(string)]; !ok {
+				violations = append(violations, docs.Violation{Path: path, Keyword: "required", Text: fmt.Sprintf("must have property %q", name)})
+			}
+		}
+	}
+
+	if dependent, ok := fields["dependentRequired"].(map[string]interface{}); ok {
+		for name, required := range dependent {
+			if _, ok := value[name]; !ok {
+				continue
+			}
+			for _, other := range required.([]interface{}) {
+				if _, ok := value[other.(string)]; !ok {
+					violations = append(violations, docs.Violation{Path: path, Keyword: "dependentRequired", Text: fmt.Sprintf("must have property %q as %q is present", other, name)})
+				}
+			}
+		}
+	}
+
+	if dependent, ok := fields["dependentSchemas"].(map[string]interface{}); ok {
+		for name, sub := range dependent {
+			if _, ok := value[name]; ok {
+				violations = append(violations, s.validate(sub, value, path, depth + 1)...)
+			}
+		}
+	}
+
+	properties, _ := fields["properties"].(map[string]interface{})
+	patterns, _ := fields["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := fields["additionalProperties"]
+	names, hasNames := fields["propertyNames"]
+
+	for _, name := range sortedKeys(value) {
+		item := value[name]
+		at := path + "/" + escape(name)
+
+		if hasNames {
+			for _, v := range s.validate(names, name, at, depth + 1) {
+				v.Text = "name " + v.Text
+				violations = append(violations, v)
+			}
+		}
+
+		matched := false
+		if sub, ok := properties[name]; ok {
+			matched = true
+			violations = append(violations, s.validate(sub, item, at, depth + 1)...)
+		}
+		for pattern, sub := range patterns {
+			if s.patterns[pattern].MatchString(name) {
+				matched = true
+				violations = append(violations, s.validate(sub, item, at, depth + 1)...)
+			}
+		}
+		if !matched && hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				violations = append(violations, docs.Violation{Path: at, Keyword: "additionalProperties", Text: "property is not allowed"})
+			} else {
+				violations = append(violations, s.validate(additional, item, at, depth + 1)...)
+			}
+		}
+	}
+
+	return
+}
+
+func matchType(typ, value interface{}) bool {
+	names, ok := typ.([]interface{})
+	if !ok {
+		names = []interface{}{typ}
+	}
+
+	for _, name := range names {
+		switch name {
+		case "null":
+			if value == nil {
+				return true
+			}
+		case "boolean":
+			if _, ok := value.(bool); ok {
+				return true
+			}
+		case "object":
+			if _, ok := value.(map[string]interface{}); ok {
+				return true
+			}
+		case "array":
+			if _, ok := value.([]interface{}); ok {
+				return true
+			}
+		case "string":
+			if _, ok := value.(string); ok {
+				return true
+			}
+		case "number":
+			if _, ok := value.(json.Number); ok {
+				return true
+			}
+		case "integer":
+			if n, ok := number(value); ok && n.IsInt() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func typeNames(typ interface{}) string {
+	names, ok := typ.([]interface{})
+	if !ok {
+		return fmt.Sprint(typ)
+	}
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprint(name)
+	}
+	return strings.Join(parts, " or ")
+}
+
+func number(value interface{}) (*big.Rat, bool) {
+	n, ok := value.(json.Number)
+	if !ok {
+		return nil, false
+	}
+	return new(big.Rat).SetString(n.String())
+}
+
+func count(value interface{}) (int, bool) {
+	n, ok := number(value)
+	if !ok || !n.IsInt() || !n.Num().IsInt64() {
+		return 0, false
+	}
+	return int(n.Num().Int64()), true
+}
+
+func isStrings(value interface{}) bool {
+	items, ok := value.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, item := range items {
+		if _, ok := item.(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// equal compares values as json does, 1 and 1.0 are equal
+func equal(a, b interface{}) bool {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, item := range x {
+			other, ok := y[key]
+			if !ok || !equal(item, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		m, okM := number(x)
+		n, okN := number(b)
+		return okM && okN && m.Cmp(n) == 0
+	}
+	return a == b
+}
+
+func show(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// escape makes name a json pointer token
+func escape(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
+
+func sortedKeys(value map[string]interface{}) []string {
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
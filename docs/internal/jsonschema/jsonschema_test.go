@@ -0,0 +1,198 @@
+package jsonschema
+
+import (
+	"fmt"
+	"errors"
+	"strings"
+	"testing"
+	"reflect"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		ok      bool
+	}{
+		{"true", `true`, true},
+		{"false", `false`, true},
+		{"empty", `{}`, true},
+		{"dialect", `{"$schema":"https://json-schema.org/draft/2020-12/schema"}`, true},
+		{"annotations and unknown keywords", `{"title":"t","format":"email","x-note":1}`, true},
+		{"local ref", `{"$defs":{"a":{"type":"string"}},"$ref":"#/$defs/a"}`, true},
+		{"recursive ref", `{"properties":{"child":{"$ref":"#"}}}`, true},
+		{"escaped ref", `{"$defs":{"a/b":{}},"$ref":"#/$defs/a~1b"}`, true},
+		{"not json", `{`, false},
+		{"trailing data", `{} {}`, false},
+		{"not a schema", `[]`, false},
+		{"other dialect", `{"$schema":"http://json-schema.org/draft-07/schema#"}`, false},
+		{"unsupported keyword", `{"unevaluatedProperties":false}`, false},
+		{"nested id", `{"properties":{"a":{"$id":"x"}}}`, false},
+		{"unknown type", `{"type":"int"}`, false},
+		{"bad type list", `{"type":["string",1]}`, false},
+		{"bad minimum", `{"minimum":"1"}`, false},
+		{"zero multipleOf", `{"multipleOf":0}`, false},
+		{"negative count", `{"minLength":-1}`, false},
+		{"fraction count", `{"maxItems":1.5}`, false},
+		{"bad pattern", `{"pattern":"("}`, false},
+		{"bad pattern property", `{"patternProperties":{"(":{}}}`, false},
+		{"empty allOf", `{"allOf":[]}`, false},
+		{"bad subschema", `{"items":1}`, false},
+		{"bad required", `{"required":[1]}`, false},
+		{"bad dependentRequired", `{"dependentRequired":{"a":"b"}}`, false},
+		{"bad enum", `{"enum":1}`, false},
+		{"remote ref", `{"$ref":"other.json#/a"}`, false},
+		{"missing ref", `{"$ref":"#/$defs/none"}`, false},
+		{"ref to non schema", `{"$defs":{"a":1},"$ref":"#/$defs/a"}`, false},
+		{"bad ref target", `{"$defs":{"a":{"type":"int"}},"$ref":"#/$defs/a"}`, false},
+		{"endless ref", `{"$defs":{"a":{"$ref":"#/$defs/a"}},"$ref":"#/$defs/a"}`, false},
+		{"ref to itself in allOf", `{"allOf":[{"$ref":"#"},{"$ref":"#"}]}`, false},
+		{"ref cycle over defs", `{"$defs":{"a":{"not":{"$ref":"#/$defs/b"}},"b":{"anyOf":[{"$ref":"#/$defs/a"}]}},"$ref":"#/$defs/a"}`, false},
+		{"ref cycle in dependentSchemas", `{"dependentSchemas":{"a":{"$ref":"#"}}}`, false},
+		{"ref cycle through items", `{"items":{"$ref":"#"},"allOf":[{"$ref":"#/$defs/a"}],"$defs":{"a":{}}}`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Compile([]byte(test.schema))
+			if test.ok && err != nil {
+				t.Fatalf("Compile(%s): %v", test.schema, err)
+			}
+			if !test.ok && !errors.Is(err, docs.ErrBadSchema) {
+				t.Fatalf("Compile(%s) error %v, want ErrBadSchema", test.schema, err)
+			}
+		})
+	}
+}
+
+// TestValidate lists violations as path and keyword, none if document is valid
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		schema    string
+		document  string
+		want      []string
+	}{
+		{"true", `true`, `{"a":1}`, nil},
+		{"false", `false`, `1`, []string{" false"}},
+		{"type", `{"type":"string"}`, `"a"`, nil},
+		{"wrong type", `{"type":"string"}`, `1`, []string{" type"}},
+		{"type list", `{"type":["string","null"]}`, `null`, nil},
+		{"integer", `{"type":"integer"}`, `2.0`, nil},
+		{"not integer", `{"type":"integer"}`, `2.5`, []string{" type"}},
+		{"enum", `{"enum":["a",1]}`, `1.0`, nil},
+		{"not in enum", `{"enum":["a",1]}`, `"b"`, []string{" enum"}},
+		{"const", `{"const":{"a":[1]}}`, `{"a":[1]}`, nil},
+		{"other const", `{"const":{"a":[1]}}`, `{"a":[2]}`, []string{" const"}},
+		{"minimum", `{"minimum":1}`, `1`, nil},
+		{"below minimum", `{"minimum":1}`, `0.99`, []string{" minimum"}},
+		{"exclusive bounds", `{"exclusiveMinimum":0,"exclusiveMaximum":1}`, `1`, []string{" exclusiveMaximum"}},
+		{"maximum", `{"maximum":10}`, `11`, []string{" maximum"}},
+		{"multipleOf exact", `{"multipleOf":0.1}`, `0.3`, nil},
+		{"not multiple", `{"multipleOf":2}`, `3`, []string{" multipleOf"}},
+		{"large numbers exact", `{"maximum":9007199254740993}`, `9007199254740994`, []string{" maximum"}},
+		{"string length in characters", `{"minLength":2,"maxLength":2}`, `"жж"`, nil},
+		{"too short", `{"minLength":2}`, `"a"`, []string{" minLength"}},
+		{"too long", `{"maxLength":1}`, `"ab"`, []string{" maxLength"}},
+		{"pattern", `{"pattern":"^[a-z]+$"}`, `"abc"`, nil},
+		{"pattern mismatch", `{"pattern":"^[a-z]+$"}`, `"ab1"`, []string{" pattern"}},
+		{"items", `{"items":{"type":"number"}}`, `[1,"a",2,true]`, []string{"/1 type", "/3 type"}},
+		{"prefixItems", `{"prefixItems":[{"type":"string"}],"items":{"type":"number"}}`, `["a",1,"b"]`, []string{"/2 type"}},
+		{"item counts", `{"minItems":2,"maxItems":3}`, `[1]`, []string{" minItems"}},
+		{"uniqueItems", `{"uniqueItems":true}`, `[1,{"a":1},1.0]`, []string{" uniqueItems"}},
+		{"unique", `{"uniqueItems":true}`, `[1,"1",[1]]`, nil},
+		{"contains", `{"contains":{"const":1}}`, `[2,1]`, nil},
+		{"contains none", `{"contains":{"const":1}}`, `[2,3]`, []string{" contains"}},
+		{"contains bounds", `{"contains":{"const":1},"minContains":2,"maxContains":2}`, `[1,1,1]`, []string{" maxContains"}},
+		{"required", `{"required":["a","b"]}`, `{"a":1}`, []string{" required"}},
+		{"properties", `{"properties":{"a":{"type":"string"}}}`, `{"a":1,"b":1}`, []string{"/a type"}},
+		{"additionalProperties false", `{"properties":{"a":{}},"additionalProperties":false}`, `{"a":1,"b":2}`, []string{"/b additionalProperties"}},
+		{"additionalProperties schema", `{"properties":{"a":{}},"additionalProperties":{"type":"string"}}`, `{"a":1,"b":2}`, []string{"/b type"}},
+		{"patternProperties", `{"patternProperties":{"^x-":{"type":"string"}},"additionalProperties":false}`, `{"x-a":"s","x-b":1}`, []string{"/x-b type"}},
+		{"escaped property path", `{"properties":{"a/b~c":{"type":"string"}}}`, `{"a/b~c":1}`, []string{"/a~1b~0c type"}},
+		{"propertyNames", `{"propertyNames":{"maxLength":2}}`, `{"ab":1,"abc":2}`, []string{"/abc maxLength"}},
+		{"property counts", `{"minProperties":1,"maxProperties":1}`, `{}`, []string{" minProperties"}},
+		{"dependentRequired", `{"dependentRequired":{"card":["billing"]}}`, `{"card":1}`, []string{" dependentRequired"}},
+		{"dependentRequired absent", `{"dependentRequired":{"card":["billing"]}}`, `{"other":1}`, nil},
+		{"dependentSchemas", `{"dependentSchemas":{"card":{"required":["billing"]}}}`, `{"card":1}`, []string{" required"}},
+		{"allOf", `{"allOf":[{"type":"number"},{"minimum":5}]}`, `3`, []string{" minimum"}},
+		{"anyOf", `{"anyOf":[{"type":"string"},{"minimum":5}]}`, `3`, []string{" anyOf"}},
+		{"anyOf matched", `{"anyOf":[{"type":"string"},{"minimum":5}]}`, `"a"`, nil},
+		{"oneOf", `{"oneOf":[{"type":"number"},{"type":"integer"}]}`, `1.5`, nil},
+		{"oneOf both", `{"oneOf":[{"type":"number"},{"type":"integer"}]}`, `1`, []string{" oneOf"}},
+		{"not", `{"not":{"type":"null"}}`, `null`, []string{" not"}},
+		{"if then", `{"if":{"properties":{"kind":{"const":"a"}}},"then":{"required":["x"]},"else":{"required":["y"]}}`, `{"kind":"a"}`, []string{" required"}},
+		{"if else", `{"if":{"properties":{"kind":{"const":"a"}}},"then":{"required":["x"]},"else":{"required":["y"]}}`, `{"kind":"b","y":1}`, nil},
+		{"ref", `{"$defs":{"name":{"type":"string"}},"properties":{"a":{"$ref":"#/$defs/name"}}}`, `{"a":1}`, []string{"/a type"}},
+		{"recursive ref", `{"type":"object","properties":{"child":{"$ref":"#"}}}`, `{"child":{"child":1}}`, []string{"/child/child type"}},
+		{"deep ref", `{"$defs":{"a":{"items":{"$ref":"#/$defs/a"}}},"$ref":"#/$defs/a"}`, strings.Repeat("[", 70) + strings.Repeat("]", 70), []string{strings.Repeat("/0", 32) + " $ref"}},
+		{"nested paths", `{"properties":{"items":{"items":{"required":["id"]}}}}`, `{"items":[{"id":1},{}]}`, []string{"/items/1 required"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schema, err := Compile([]byte(test.schema))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			violations, err := schema.Validate([]byte(test.document))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, v := range violations {
+				got = append(got, v.Path + " " + v.Keyword)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("violations %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateBounds(t *testing.T) {
+	schema, err := Compile([]byte(`{"items":{"type":"string"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document := []byte("[" + strings.Repeat("1,", maxViolations * 2) + "1]")
+	violations, err := schema.Validate(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != maxViolations {
+		t.Errorf("%d violations reported, want %d", len(violations), maxViolations)
+	}
+
+	_, err = schema.Validate([]byte(`[1`))
+	if err == nil {
+		t.Error("bad document validated")
+	}
+}
+
+// TestValidateSteps applies each of 24 definitions twice,
+// 2^24 subschemas in all, validation must stop early
+func TestValidateSteps(t *testing.T) {
+	var defs []string
+	for i := 0; i < 24; i++ {
+		defs = append(defs, fmt.Sprintf(`"d%d":{"allOf":[{"$ref":"#/$defs/d%d"},{"$ref":"#/$defs/d%d"}]}`, i, i + 1, i + 1))
+	}
+	defs = append(defs, `"d24":{"not":{"const":1}}`)
+
+	schema, err := Compile([]byte(`{"$defs":{` + strings.Join(defs, ",") + `},"$ref":"#/$defs/d0"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	violations, err := schema.Validate([]byte(`1`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 1 || violations[0].Keyword != "$schema" {
+		t.Errorf("violations %v, want one of $schema", violations)
+	}
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"io"
+	"fmt"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/jackc/pgx/v5"
+	"github.com/bd878/doc_server/docs/internal/blob"
+)
+
+// settleBlobs removes blobs once transaction is over, err is its outcome:
+// released ones are not referenced after commit, stored ones are
+// left without row when it failed. Blobs are outside of transaction,
+// so removing them any earlier could lose content of rolled back rows
+func settleBlobs(ctx context.Context, log zerolog.Logger, blobs blob.Store, err error, stored, released []string) {
+	if err != nil {
+		released = stored
+	}
+
+	// client may be gone, cleanup is done anyway
+	ctx = context.WithoutCancel(ctx)
+
+	for _, key := range released {
+		if err := blobs.Delete(ctx, key); err != nil && err != blob.ErrNoBlob {
+			log.Error().Err(err).Str("key", key).Msg("failed to delete blob")
+		}
+	}
+}
+
+// blobRefs shares one blob between documents and versions of
+// identical content, tableName counts references to each blob
+type blobRefs struct {
+	tableName  string
+	blobs      blob.Store
+}
+
+// put streams content into a new blob, hashing it on the way
+func (b blobRefs) put(ctx context.Context, r io.Reader) (key, digest string, size int64, err error) {
+	hash := sha256.New()
+
+	key = uuid.New().String()
+	size, err = b.blobs.Put(ctx, key, io.TeeReader(r, hash))
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	return key, hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// ref references stored blob of digest content. If same content is
+// kept already, that blob gains a reference and its key is returned,
+// stored one is not needed then
+func (b blobRefs) ref(ctx context.Context, tx pgx.Tx, stored, digest string, size int64) (key string, err error) {
+	const query = "INSERT INTO %s AS b(key, sha256, size) VALUES ($1, $2, $3) ON CONFLICT (sha256) DO UPDATE SET refs = b.refs + 1 RETURNING key"
+
+	err = tx.QueryRow(ctx, b.table(query), stored, digest, size).Scan(&key)
+
+	return
+}
+
+// addRef references blob already kept
+func (b blobRefs) addRef(ctx context.Context, tx pgx.Tx, key string) (err error) {
+	const query = "UPDATE %s SET refs = refs + 1 WHERE key = $1"
+
+	_, err = tx.Exec(ctx, b.table(query), key)
+
+	return
+}
+
+// unref drops one reference per key, keys may repeat.
+// Blobs referenced no more are returned to be removed after commit
+func (b blobRefs) unref(ctx context.Context, tx pgx.Tx, keys []string) (released []string, err error) {
+	const query = "UPDATE %s AS b SET refs = b.refs - d.n FROM (SELECT key, count(*) AS n FROM unnest($1::text[]) AS key GROUP BY key) AS d WHERE b.key = d.key RETURNING b.key, b.refs"
+	const deleteQuery = "DELETE FROM %s WHERE key = ANY($1)"
+
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	rows, err := tx.Query(ctx, b.table(query), keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var key string
+		var refs int
+		err = rows.Scan(&key, &refs)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if refs <= 0 {
+			released = append(released, key)
+		}
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(released) == 0 {
+		return nil, nil
+	}
+
+	_, err = tx.Exec(ctx, b.table(deleteQuery), released)
+	if err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+func (b blobRefs) table(query string) string {
+	return fmt.Sprintf(query, b.tableName)
+}
@@ -7,31 +7,93 @@ import (
 	"time"
 	"context"
 	"errors"
+	"strings"
 	"encoding/json"
-	"mime/multipart"
 	"github.com/rs/zerolog"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/bd878/doc_server/docs/internal/blob"
 	docs "github.com/bd878/doc_server/docs/pkg/model"
 )
 
 type Repository struct {
 	tableName              string
+	versionsTableName      string
+	schemasTableName       string
+	foldersTableName       string
+	maxVersions            int
+	maxJSONSize            int64
+	mimes                  docs.MimePolicy
+	blobs                  blob.Store
+	refs                   blobRefs
 	pool                  *pgxpool.Pool
 	log                    zerolog.Logger
 }
 
-func New(log zerolog.Logger, tableName string, pool *pgxpool.Pool) *Repository {
+// New creates documents repository, maxVersions previous versions are kept
+// for documents with no own limit. Types outside of mimes are rejected.
+// File contents go to blobs, identical ones are stored once and counted
+// in blobsTableName. Json documents are validated with schemas of schemasTableName,
+// documents are put in folders of foldersTableName. Patched json
+// documents are at most maxJSONSize bytes
+func New(log zerolog.Logger, tableName, versionsTableName, blobsTableName, schemasTableName, foldersTableName string, maxVersions int, maxJSONSize int64, mimes docs.MimePolicy, blobs blob.Store, pool *pgxpool.Pool) *Repository {
 	return &Repository{
 		log:                   log,
 		tableName:             tableName,
+		versionsTableName:     versionsTableName,
+		schemasTableName:      schemasTableName,
+		foldersTableName:      foldersTableName,
+		maxVersions:           maxVersions,
+		maxJSONSize:           maxJSONSize,
+		mimes:                 mimes,
+		blobs:                 blobs,
+		refs:                  blobRefs{tableName: blobsTableName, blobs: blobs},
 		pool:                  pool,
 	}
 }
 
-func (r *Repository) Save(ctx context.Context, owner string, f multipart.File, jsonData []byte, meta *docs.Meta) (err error) {
-	const query = "INSERT INTO %s(id, oid, name, file, json, public, mime, owner_login, grant_logins, size) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)"
-	const createdAtQuery = "SELECT created_at FROM %s WHERE id = $1"
+func (r *Repository) Save(ctx context.Context, owner string, f io.Reader, jsonData []byte, meta *docs.Meta) (err error) {
+	const query = "INSERT INTO %s(id, blob, sha256, name, file, json, public, mime, detected_mime, owner_login, grant_logins, size, max_versions, content_text, schema_name, parent_id, folder_grants, tags, metadata, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)"
+	const createdAtQuery = "SELECT created_at, updated_at, version, revision FROM %s WHERE id = $1"
+
+	var stored, released []string
+	defer func() {
+		settleBlobs(ctx, r.log, r.blobs, err, stored, released)
+	}()
+
+	if !r.mimes.Permits(meta.Mime) {
+		return docs.ErrMimeDenied
+	}
+
+	if meta.File && meta.Schema != "" {
+		return docs.ErrNotJSON
+	}
+
+	// content is hashed while streamed, before transaction holds a connection
+	var tmp, digest string
+	var size int64
+	var text *searchText
+	if meta.File && f != nil {
+		f, text, err = r.sniff(f, meta)
+		if err != nil {
+			return err
+		}
+
+		tmp, digest, size, err = r.refs.put(ctx, f)
+		if err != nil {
+			r.log.Error().Err(err).Msg("failed to put blob")
+			return err
+		}
+		stored = append(stored, tmp)
+
+		err = checkDigest(meta.SHA256, digest)
+		if err != nil {
+			return err
+		}
+	} else {
+		size = int64(len(jsonData))
+	}
 
 	var tx pgx.Tx
 	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
@@ -45,30 +107,155 @@ func (r *Repository) Save(ctx context.Context, owner string, f multipart.File, j
 			_ = tx.Rollback(ctx)
 			panic(p)
 		case err != nil:
-			fmt.Fprintf(os.Stderr, "rollback with error: %w", err)
-			err = tx.Rollback(ctx)
+			fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
+			_ = tx.Rollback(ctx)
 		default:
 			err = tx.Commit(ctx)
 		}
 	}()
 
-	var oid uint32
+	var key, sum *string
+	if tmp != "" {
+		key, sum, released, err = r.refer(ctx, tx, tmp, digest, size)
+		if err != nil {
+			return
+		}
+	} else {
+		err = r.validate(ctx, tx, owner, meta.Schema, jsonData)
+		if err != nil {
+			return
+		}
+	}
+
+	meta.Inherited, err = r.folderGrants(ctx, tx, owner, meta.ParentID)
+	if err != nil {
+		return
+	}
+
+	grant, err := marshalGrant(meta.Grant)
+	if err != nil {
+		return
+	}
+	inherited, err := marshalGrant(meta.Inherited)
+	if err != nil {
+		return
+	}
+	tags, metadata, err := marshalLabels(meta)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.Exec(ctx, r.table(query), meta.ID, key, sum, meta.Name, key != nil, jsonData, meta.Public, meta.Mime, nullable(meta.Detected), owner, grant, size, meta.MaxVersions, contentText(text, jsonData), nullable(meta.Schema), nullable(meta.ParentID), inherited, tags, metadata, expiry(meta))
+	if err != nil {
+		return
+	}
+
+	var created, updated time.Time
+	err = tx.QueryRow(ctx, r.table(createdAtQuery), meta.ID).Scan(&created, &updated, &meta.Version, &meta.Revision)
+	if err != nil {
+		return
+	}
+
+	if key != nil {
+		meta.Blob = *key
+		meta.SHA256 = *sum
+	} else {
+		meta.SHA256 = ""
+		meta.Detected = ""
+	}
+	meta.Owner = owner
+	meta.Ts = created.UnixNano()
+	meta.Created = created.Format(time.DateTime)
+	meta.Updated = updated.Format(time.DateTime)
+	meta.UpdatedTs = updated.UnixNano()
+	meta.Size = size
+
+	return
+}
+
+// sniff detects type of file content f, which must be allowed.
+// Returned reader yields whole content again, text of text
+// files is kept while it is read
+func (r *Repository) sniff(f io.Reader, meta *docs.Meta) (content io.Reader, text *searchText, err error) {
+	meta.Detected, content, err = sniffMime(f, meta.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !r.mimes.Permits(meta.Detected) {
+		r.log.Warn().Str("declared", meta.Mime).Str("detected", meta.Detected).Msg("mime type denied")
+		return nil, nil, docs.ErrMimeDenied
+	}
+
+	content, text = captureText(meta.Detected, content)
+
+	return content, text, nil
+}
+
+// checkDigest compares content digest with one expected by client, if any
+func checkDigest(expected, digest string) error {
+	if expected != "" && !strings.EqualFold(expected, digest) {
+		return docs.ErrChecksum
+	}
+	return nil
+}
+
+// refer references stored blob of digest content, or the blob kept
+// for the same content already. Stored one is released in that case
+func (r *Repository) refer(ctx context.Context, tx pgx.Tx, stored, digest string, size int64) (key, sum *string, released []string, err error) {
+	shared, err := r.refs.ref(ctx, tx, stored, digest, size)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if shared != stored {
+		r.log.Log().Str("key", shared).Str("sha256", digest).Msg("same content kept already")
+		released = append(released, stored)
+	}
+
+	return &shared, &digest, released, nil
+}
+
+// Update replaces document content and metadata, ifMatch is
+// If-Match header value to check current revision against, if any
+func (r *Repository) Update(ctx context.Context, login, id, ifMatch string, f io.Reader, jsonData []byte, meta *docs.Meta) (err error) {
+	const selectQuery = "SELECT " + metaColumns + " FROM %s WHERE id = $1 AND deleted_at IS NULL AND (public OR owner_login = $2 OR grant_logins @> ANY($3::jsonb[]) OR folder_grants @> ANY($3::jsonb[])) FOR UPDATE"
+	const query = "UPDATE %s SET blob = $2, sha256 = $3, name = $4, file = $5, json = $6, public = $7, mime = $8, detected_mime = $9, grant_logins = $10, size = $11, max_versions = COALESCE($12, max_versions), content_text = $13, schema_name = $14, tags = $15, metadata = $16, expires_at = $17, version = version + 1, revision = revision + 1, updated_at = NOW() WHERE id = $1 RETURNING created_at, updated_at, version, max_versions, revision"
+
+	r.log.Log().Str("login", login).Str("id", id).Msg("update doc")
+
+	var stored, released []string
+	defer func() {
+		settleBlobs(ctx, r.log, r.blobs, err, stored, released)
+	}()
+
+	if !r.mimes.Permits(meta.Mime) {
+		return docs.ErrMimeDenied
+	}
+
+	if meta.File && meta.Schema != "" {
+		return docs.ErrNotJSON
+	}
+
+	// content is hashed while streamed, before transaction locks the row,
+	// blob is released if update fails
+	var tmp, digest string
 	var size int64
+	var text *searchText
 	if meta.File && f != nil {
-		lb := tx.LargeObjects()
-		oid, err = lb.Create(ctx, 0)
+		f, text, err = r.sniff(f, meta)
 		if err != nil {
-			r.log.Error().Err(err).Msg("failed to create large object")
 			return err
 		}
 
-		object, err := lb.Open(ctx, oid, pgx.LargeObjectModeWrite)
+		tmp, digest, size, err = r.refs.put(ctx, f)
 		if err != nil {
+			r.log.Error().Err(err).Msg("failed to put blob")
 			return err
 		}
-		defer object.Close()
+		stored = append(stored, tmp)
 
-		size, err = io.Copy(object, f)
+		err = checkDigest(meta.SHA256, digest)
 		if err != nil {
 			return err
 		}
@@ -76,185 +263,612 @@ func (r *Repository) Save(ctx context.Context, owner string, f multipart.File, j
 		size = int64(len(jsonData))
 	}
 
-	grant, err := json.Marshal(meta.Grant)
+	var tx pgx.Tx
+	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
+		return err
+	}
+	defer func() {
+		p := recover()
+		switch {
+		case p != nil:
+			_ = tx.Rollback(ctx)
+			panic(p)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
+			_ = tx.Rollback(ctx)
+		default:
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	prev, err := scanMeta(tx.QueryRow(ctx, r.table(selectQuery), id, login, grantPatterns(login, docs.PermissionRead)))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return docs.ErrNoDoc
+		}
 		return
 	}
 
-	// no file, only json
-	if oid == 0 {
-		_, err = tx.Exec(ctx, r.table(query), meta.ID, nil, meta.Name, false, jsonData, meta.Public, meta.Mime, owner, grant, size)
+	if prev.Expired(time.Now()) {
+		return docs.ErrExpired
+	}
+
+	// sharing settings are changed by those who may re-share only
+	need := docs.PermissionWrite
+	if prev.Public != meta.Public || !docs.SameGrants(prev.Grant, meta.Grant) {
+		need = docs.PermissionShare
+	}
+	if !prev.Allowed(login, need) {
+		return docs.ErrForbidden
+	}
+
+	if ifMatch != "" && !docs.MatchETag(ifMatch, prev.ETag(), false) {
+		return docs.ErrPrecondition
+	}
+
+	// content is replaced as a whole, previous one goes to history
+	err = r.archive(ctx, tx, id)
+	if err != nil {
+		return
+	}
+
+	var key, sum *string
+	if tmp != "" {
+		key, sum, released, err = r.refer(ctx, tx, tmp, digest, size)
 		if err != nil {
 			return
 		}
 	} else {
-		_, err = tx.Exec(ctx, r.table(query), meta.ID, oid, meta.Name, true, jsonData, meta.Public, meta.Mime, owner, grant, size)
+		err = r.validate(ctx, tx, prev.Owner, meta.Schema, jsonData)
 		if err != nil {
 			return
 		}
 	}
 
-	var created time.Time
-	err = tx.QueryRow(ctx, r.table(createdAtQuery), meta.ID).Scan(&created)
+	grant, err := marshalGrant(meta.Grant)
+	if err != nil {
+		return
+	}
+	tags, metadata, err := marshalLabels(meta)
 	if err != nil {
 		return
 	}
 
+	var created, updated time.Time
+	err = tx.QueryRow(ctx, r.table(query), id, key, sum, meta.Name, key != nil, jsonData, meta.Public, meta.Mime, nullable(meta.Detected), grant, size, meta.MaxVersions, contentText(text, jsonData), nullable(meta.Schema), tags, metadata, expiry(meta)).Scan(&created, &updated, &meta.Version, &meta.MaxVersions, &meta.Revision)
+	if err != nil {
+		return
+	}
+
+	pruned, err := r.prune(ctx, tx, id, meta.MaxVersions)
+	if err != nil {
+		return
+	}
+	released = append(released, pruned...)
+
+	meta.ID = id
+	meta.Owner = prev.Owner
+	meta.ParentID = prev.ParentID
+	meta.Inherited = prev.Inherited
+	meta.File = key != nil
+	meta.Size = size
 	meta.Ts = created.UnixNano()
 	meta.Created = created.Format(time.DateTime)
-	meta.Size = size
+	meta.Updated = updated.Format(time.DateTime)
+	meta.UpdatedTs = updated.UnixNano()
+	if key != nil {
+		meta.Blob = *key
+		meta.SHA256 = *sum
+	} else {
+		meta.Blob = ""
+		meta.SHA256 = ""
+		meta.Detected = ""
+	}
 
 	return
 }
 
-func (r *Repository) List(ctx context.Context, owner, login, key string, value interface{}, limit int) (list []*docs.Meta, err error) {
-	const queryLogin = "SELECT id, oid, name, file, public, mime, created_at, grant_logins, size FROM %s, jsonb_array_elements_text(grant_logins) AS login WHERE %s = $2 AND login = $1 ORDER BY created_at DESC LIMIT $3"
-	const query = "SELECT id, oid, name, file, public, mime, created_at, grant_logins, size FROM %s WHERE %s = $2 AND owner_login = $1 ORDER BY created_at DESC LIMIT $3"
+func (r *Repository) UpdateMeta(ctx context.Context, login, id, ifMatch string, patch *docs.UpdateMeta) (meta *docs.Meta, err error) {
+	r.log.Log().Str("login", login).Str("id", id).Msg("update meta")
 
-	r.log.Log().Str("owner", owner).Str("login", login).Str("key", key).Any("value", value).Int("limit", limit).Msg("list docs")
+	return r.modifyMeta(ctx, login, id, ifMatch, func(meta *docs.Meta) error {
+		need := docs.PermissionWrite
+		if patch.Public != nil || patch.Grant != nil {
+			need = docs.PermissionShare
+		}
+		if !meta.Allowed(login, need) {
+			return docs.ErrForbidden
+		}
 
-	var rows pgx.Rows
-	if login == "" {
-		rows, err = r.pool.Query(ctx, fmt.Sprintf(query, r.tableName, key), owner, value, limit)
-		if err != nil {
-			return
+		if patch.Name != nil {
+			meta.Name = *patch.Name
 		}
-	} else {
-		rows, err = r.pool.Query(ctx, fmt.Sprintf(queryLogin, r.tableName, key), login, value, limit)
-		if err != nil {
-			return
+		if patch.Mime != nil {
+			if !r.mimes.Permits(*patch.Mime) {
+				return docs.ErrMimeDenied
+			}
+			meta.Mime = *patch.Mime
+		}
+		if patch.Public != nil {
+			meta.Public = *patch.Public
+		}
+		if patch.Grant != nil {
+			meta.Grant = patch.Grant
+		}
+		if patch.MaxVersions != nil {
+			meta.MaxVersions = patch.MaxVersions
+		}
+		if patch.Schema != nil {
+			if meta.File && *patch.Schema != "" {
+				return docs.ErrNotJSON
+			}
+			meta.Schema = *patch.Schema
+		}
+		// folders are owner ones, only owner puts documents there
+		if patch.ParentID != nil && *patch.ParentID != meta.ParentID {
+			if login != meta.Owner {
+				return docs.ErrForbidden
+			}
+			meta.ParentID = *patch.ParentID
+		}
+		if patch.Tags != nil {
+			meta.Tags = *patch.Tags
+		}
+		if patch.Metadata != nil {
+			meta.Metadata = *patch.Metadata
+		}
+		if patch.Expires != nil {
+			expires, err := docs.ParseExpiry(*patch.Expires)
+			if err != nil {
+				return err
+			}
+			meta.SetExpires(expires)
+		}
+
+		return nil
+	})
+}
+
+func (r *Repository) SetGrant(ctx context.Context, login, id string, grant docs.Grant) (meta *docs.Meta, err error) {
+	r.log.Log().Str("login", login).Str("id", id).Str("grantee", grant.Login).Str("permission", string(grant.Permission)).Msg("set grant")
+
+	return r.modifyMeta(ctx, login, id, "", func(meta *docs.Meta) error {
+		if !meta.Allowed(login, docs.PermissionShare) {
+			return docs.ErrForbidden
+		}
+
+		if grant.Login == meta.Owner {
+			return docs.ErrBadPermission
+		}
+
+		meta.SetGrant(grant)
+
+		return nil
+	})
+}
+
+func (r *Repository) RevokeGrant(ctx context.Context, login, id, grantee string) (meta *docs.Meta, err error) {
+	r.log.Log().Str("login", login).Str("id", id).Str("grantee", grantee).Msg("revoke grant")
+
+	return r.modifyMeta(ctx, login, id, "", func(meta *docs.Meta) error {
+		// grantee may always give up own access
+		if login != grantee && !meta.Allowed(login, docs.PermissionShare) {
+			return docs.ErrForbidden
+		}
+
+		if !meta.RevokeGrant(grantee) {
+			return docs.ErrNoGrant
 		}
+
+		return nil
+	})
+}
+
+// modifyMeta locks the document visible to login and saves
+// metadata changed by modify, if current revision matches ifMatch
+func (r *Repository) modifyMeta(ctx context.Context, login, id, ifMatch string, modify func(meta *docs.Meta) error) (meta *docs.Meta, err error) {
+	const selectQuery = "SELECT " + metaColumns + " FROM %s WHERE id = $1 AND deleted_at IS NULL AND (public OR owner_login = $2 OR grant_logins @> ANY($3::jsonb[]) OR folder_grants @> ANY($3::jsonb[])) FOR UPDATE"
+	const query = "UPDATE %s SET name = $2, mime = $3, public = $4, grant_logins = $5, max_versions = $6, schema_name = $7, parent_id = $8, folder_grants = $9, tags = $10, metadata = $11, expires_at = $12, revision = revision + 1, updated_at = NOW() WHERE id = $1 RETURNING updated_at, revision"
+	const jsonQuery = "SELECT json FROM %s WHERE id = $1"
+
+	var released []string
+	defer func() {
+		settleBlobs(ctx, r.log, r.blobs, err, nil, released)
+	}()
+
+	var tx pgx.Tx
+	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, err
 	}
-	defer rows.Close()
+	defer func() {
+		p := recover()
+		switch {
+		case p != nil:
+			_ = tx.Rollback(ctx)
+			panic(p)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
+			_ = tx.Rollback(ctx)
+		default:
+			err = tx.Commit(ctx)
+		}
+	}()
 
-	list = make([]*docs.Meta, 0)
-	for rows.Next() {
-		meta := &docs.Meta{
+	meta, err = scanMeta(tx.QueryRow(ctx, r.table(selectQuery), id, login, grantPatterns(login, docs.PermissionRead)))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, docs.ErrNoDoc
 		}
+		return nil, err
+	}
 
-		var grant []byte
-		var created time.Time
-		var oid *uint32
+	if meta.Expired(time.Now()) {
+		return nil, docs.ErrExpired
+	}
+
+	if ifMatch != "" && !docs.MatchETag(ifMatch, meta.ETag(), false) {
+		return nil, docs.ErrPrecondition
+	}
+
+	schema, parent := meta.Schema, meta.ParentID
 
-		err = rows.Scan(&meta.ID, &oid, &meta.Name, &meta.File, &meta.Public, &meta.Mime, &created, &grant, &meta.Size)
+	err = modify(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	// moved document inherits grants of its new folder
+	if meta.ParentID != parent {
+		meta.Inherited, err = r.folderGrants(ctx, tx, meta.Owner, meta.ParentID)
 		if err != nil {
-			return
+			return nil, err
 		}
+	}
 
-		if grant != nil {
-			err = json.Unmarshal(grant, &meta.Grant)
-			if err != nil {
-				return
-			}
+	// content is checked against schema it is given
+	if !meta.File && meta.Schema != schema {
+		var jsonData []byte
+		err = tx.QueryRow(ctx, r.table(jsonQuery), id).Scan(&jsonData)
+		if err != nil {
+			return nil, err
 		}
 
-		if oid != nil {
-			meta.Oid = *oid
+		err = r.validate(ctx, tx, meta.Owner, meta.Schema, jsonData)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		meta.Created = created.Format(time.DateTime)
-		meta.Ts = created.UnixNano()
+	grant, err := marshalGrant(meta.Grant)
+	if err != nil {
+		return nil, err
+	}
+	inherited, err := marshalGrant(meta.Inherited)
+	if err != nil {
+		return nil, err
+	}
+	tags, metadata, err := marshalLabels(meta)
+	if err != nil {
+		return nil, err
+	}
 
-		list = append(list, meta)
+	var updated time.Time
+	err = tx.QueryRow(ctx, r.table(query), id, meta.Name, meta.Mime, meta.Public, grant, meta.MaxVersions, nullable(meta.Schema), nullable(meta.ParentID), inherited, tags, metadata, expiry(meta)).Scan(&updated, &meta.Revision)
+	if err != nil {
+		return nil, err
 	}
 
-	if err = rows.Err(); err != nil {
-		return
+	// retention may have been lowered
+	released, err = r.prune(ctx, tx, id, meta.MaxVersions)
+	if err != nil {
+		return nil, err
 	}
 
+	meta.Updated = updated.Format(time.DateTime)
+	meta.UpdatedTs = updated.UnixNano()
+
 	return
 }
 
-func (r *Repository) GetMeta(ctx context.Context, id, login string) (meta *docs.Meta, err error) {
-	const query = "SELECT id, oid, name, file, public, mime, created_at, grant_logins, size FROM %s, jsonb_array_elements_text(grant_logins) AS login WHERE id = $1 AND (login = $2 OR owner_login = $2)"
+// listSorts maps sort fields to columns, text is compared
+// bytewise, as cache does
+var listSorts = map[string]string{
+	docs.SortCreated:  "created_at",
+	docs.SortUpdated:  "updated_at",
+	docs.SortName:     "name COLLATE \"C\"",
+	docs.SortSize:     "size",
+}
 
-	r.log.Log().Str("id", id).Msg("get meta")
+// List lists documents matching q, next is a cursor of the
+// page following, empty if there is none
+func (r *Repository) List(ctx context.Context, q *docs.ListQuery) (list []*docs.Meta, next string, err error) {
+	defer func() {
+		err = queryError(err)
+	}()
 
-	var grant []byte
-	var created time.Time
-	var oid *uint32
+	r.log.Log().Str("owner", q.Owner).Str("login", q.Login).Str("sort", q.Sort).Bool("desc", q.Desc).Int("limit", q.Limit).Msg("list docs")
 
-	meta = &docs.Meta{}
+	column, ok := listSorts[q.Sort]
+	if !ok {
+		return nil, "", docs.ErrBadQuery
+	}
+
+	order := "ASC"
+	if q.Desc {
+		order = "DESC"
+	}
 
-	err = r.pool.QueryRow(ctx, r.table(query), id, login).Scan(&meta.ID, &oid, &meta.Name, &meta.File, &meta.Public, &meta.Mime, &created, &grant, &meta.Size)
+	where, args := listWhere(q, column)
+	args = append(args, q.Limit+1)
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s %s, id COLLATE \"C\" %s LIMIT $%d", metaColumns, r.tableName, where, column, order, order, len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
 	if err != nil {
-		if errors.Is(pgx.ErrNoRows, err) {
-			err = docs.ErrNoDoc
-		}
-		return nil, err
+		return
 	}
+	defer rows.Close()
 
-	if grant != nil {
-		err = json.Unmarshal(grant, &meta.Grant)
+	list = make([]*docs.Meta, 0)
+	for rows.Next() {
+		var meta *docs.Meta
+		meta, err = scanMeta(rows)
 		if err != nil {
 			return
 		}
+
+		list = append(list, meta)
 	}
 
-	if oid != nil {
-		meta.Oid = *oid
+	if err = rows.Err(); err != nil {
+		return
 	}
 
-	meta.Created = created.Format(time.DateTime)
-	meta.Ts = created.UnixNano()
+	// one more row than asked tells there is a next page
+	if len(list) > q.Limit {
+		list = list[:q.Limit]
+		next = q.NextCursor(list[len(list)-1])
+	}
 
 	return
 }
 
-func (r *Repository) ReadFile(ctx context.Context, oid uint32, writer io.Writer) (err error) {
-	var tx pgx.Tx
-	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
+// Summary counts documents matching q filters, cursor and limit aside
+func (r *Repository) Summary(ctx context.Context, q *docs.ListQuery) (summary *docs.ListSummary, err error) {
+	defer func() {
+		err = queryError(err)
+	}()
+
+	r.log.Log().Str("owner", q.Owner).Str("login", q.Login).Msg("summarize docs")
+
+	filter := *q
+	filter.Cursor = nil
+
+	where, args := listWhere(&filter, "")
+	query := fmt.Sprintf("SELECT count(*), COALESCE(sum(size), 0)::bigint, max(updated_at) FROM %s WHERE %s", r.tableName, where)
+
+	var modified *time.Time
+
+	summary = &docs.ListSummary{}
+	err = r.pool.QueryRow(ctx, query, args...).Scan(&summary.Count, &summary.Size, &modified)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer func() {
-		p := recover()
-		switch {
-		case p != nil:
-			_ = tx.Rollback(ctx)
-			panic(p)
-		case err != nil:
-			fmt.Fprintf(os.Stderr, "rollback with error: %w", err)
-			err = tx.Rollback(ctx)
-		default:
-			err = tx.Commit(ctx)
+
+	if modified != nil {
+		summary.Modified = *modified
+	}
+
+	return
+}
+
+// queryError tells client mistakes in query values, as bad jsonpath
+// (syntax error, 42601) or bad json (data exceptions, class 22),
+// from failures of server
+func queryError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && (pgErr.Code == "42601" || strings.HasPrefix(pgErr.Code, "22")) {
+		return fmt.Errorf("%w: %s", docs.ErrBadQuery, pgErr.Message)
+	}
+	return err
+}
+
+// listWhere builds condition of q filters, only values go to args,
+// column is the sort column cursor is compared with
+func listWhere(q *docs.ListQuery, column string) (where string, args []interface{}) {
+	conds := []string{"deleted_at IS NULL", "(expires_at IS NULL OR expires_at > NOW())"}
+	add := func(cond string, values ...interface{}) {
+		n := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			args = append(args, value)
+			n = append(n, len(args))
 		}
-	}()
+		conds = append(conds, fmt.Sprintf(cond, n...))
+	}
+
+	if q.Login != "" {
+		add("(grant_logins @> ANY($%[1]d::jsonb[]) OR folder_grants @> ANY($%[1]d::jsonb[]))", grantPatterns(q.Login, docs.PermissionRead))
+	} else {
+		add("owner_login = $%d", q.Owner)
+	}
+
+	if q.ParentID != nil {
+		if *q.ParentID == "" {
+			add("parent_id IS NULL")
+		} else {
+			add("parent_id = $%d", *q.ParentID)
+		}
+	}
+	if q.Name != nil {
+		add("name = $%d", *q.Name)
+	}
+	if q.NamePrefix != nil {
+		add("starts_with(name, $%d)", *q.NamePrefix)
+	}
+	if q.Mime != nil {
+		add("mime = $%d", *q.Mime)
+	}
+	if q.File != nil {
+		add("file = $%d", *q.File)
+	}
+	if q.Public != nil {
+		add("public = $%d", *q.Public)
+	}
+	if q.CreatedAfter != nil {
+		add("created_at >= $%d", *q.CreatedAfter)
+	}
+	if q.CreatedBefore != nil {
+		add("created_at < $%d", *q.CreatedBefore)
+	}
+	if q.MinSize != nil {
+		add("size >= $%d", *q.MinSize)
+	}
+	if q.MaxSize != nil {
+		add("size <= $%d", *q.MaxSize)
+	}
+	if q.JSONContains != nil {
+		add("json @> $%d::jsonb", []byte(q.JSONContains))
+	}
+	if q.JSONPath != nil {
+		add("json @@ $%d::jsonpath", *q.JSONPath)
+	}
+	if len(q.Tags) > 0 {
+		tags, _ := json.Marshal(q.Tags)
+		add("tags @> $%d::jsonb", tags)
+	}
+	if len(q.Metadata) > 0 {
+		metadata, _ := json.Marshal(q.Metadata)
+		add("metadata @> $%d::jsonb", metadata)
+	}
+
+	if c := q.Cursor; c != nil {
+		op := ">"
+		if q.Desc {
+			op = "<"
+		}
+
+		var value interface{}
+		switch q.Sort {
+		case docs.SortCreated, docs.SortUpdated:
+			value = time.Unix(0, c.Value)
+		case docs.SortName:
+			value = c.Name
+		case docs.SortSize:
+			value = c.Value
+		}
+
+		add("(" + column + ", id COLLATE \"C\") " + op + " ($%d, $%d)", value, c.ID)
+	}
 
-	lb := tx.LargeObjects()
-	object, err := lb.Open(ctx, oid, pgx.LargeObjectModeRead)
+	return strings.Join(conds, " AND "), args
+}
+
+func (r *Repository) ListPublic(ctx context.Context, owner string, limit int) (list []*docs.Meta, err error) {
+	const query = "SELECT " + metaColumns + " FROM %s WHERE owner_login = $1 AND public AND deleted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW()) ORDER BY created_at DESC LIMIT $2"
+
+	r.log.Log().Str("owner", owner).Int("limit", limit).Msg("list public docs")
+
+	rows, err := r.pool.Query(ctx, r.table(query), owner, limit)
 	if err != nil {
-		return err
+		return
 	}
+	defer rows.Close()
+
+	list = make([]*docs.Meta, 0)
+	for rows.Next() {
+		var meta *docs.Meta
+		meta, err = scanMeta(rows)
+		if err != nil {
+			return
+		}
+
+		list = append(list, meta)
+	}
+
+	err = rows.Err()
+
+	return
+}
 
-	_, err = io.Copy(writer, object)
+func (r *Repository) GetMeta(ctx context.Context, id, login string) (meta *docs.Meta, err error) {
+	const query = "SELECT " + metaColumns + " FROM %s WHERE id = $1 AND deleted_at IS NULL AND (public OR owner_login = $2 OR grant_logins @> ANY($3::jsonb[]) OR folder_grants @> ANY($3::jsonb[]))"
+
+	r.log.Log().Str("id", id).Msg("get meta")
+
+	meta, err = scanMeta(r.pool.QueryRow(ctx, r.table(query), id, login, grantPatterns(login, docs.PermissionRead)))
 	if err != nil {
-		return err
+		if errors.Is(pgx.ErrNoRows, err) {
+			err = docs.ErrNoDoc
+		}
+		return nil, err
 	}
 
-	object.Close()
+	return
+}
+
+// FindMeta returns document regardless of who asks,
+// callers must check access themselves. Trash is not looked in
+func (r *Repository) FindMeta(ctx context.Context, id string) (meta *docs.Meta, err error) {
+	const query = "SELECT " + metaColumns + " FROM %s WHERE id = $1 AND deleted_at IS NULL"
+
+	meta, err = scanMeta(r.pool.QueryRow(ctx, r.table(query), id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = docs.ErrNoDoc
+		}
+		return nil, err
+	}
 
 	return
 }
 
-func (r *Repository) ReadJSON(ctx context.Context, id string) (result json.RawMessage, err error) {
+func (r *Repository) ReadFile(ctx context.Context, key string, writer io.Writer) (err error) {
+	return r.blobs.Get(ctx, key, writer)
+}
+
+// ReadFileRange writes length bytes of file content starting at start
+func (r *Repository) ReadFileRange(ctx context.Context, key string, start, length int64, writer io.Writer) (err error) {
+	return r.blobs.Range(ctx, key, start, length, writer)
+}
+
+// ReadJSON reads json document, path selects a part of it,
+// first one if path matches many
+func (r *Repository) ReadJSON(ctx context.Context, id, path string) (result json.RawMessage, err error) {
 	const query = "SELECT json FROM %s WHERE id = $1"
+	const pathQuery = "SELECT jsonb_path_query_first(json, $2::jsonpath) FROM %s WHERE id = $1"
 
 	var jsonData []byte
 
-	err = r.pool.QueryRow(ctx, r.table(query), id).Scan(&jsonData)
+	if path == "" {
+		err = r.pool.QueryRow(ctx, r.table(query), id).Scan(&jsonData)
+		if err != nil {
+			return
+		}
+
+		return json.RawMessage(jsonData), nil
+	}
+
+	err = r.pool.QueryRow(ctx, r.table(pathQuery), id, path).Scan(&jsonData)
 	if err != nil {
-		return
+		return nil, queryError(err)
+	}
+
+	if jsonData == nil {
+		return nil, docs.ErrNoPath
 	}
 
 	return json.RawMessage(jsonData), nil
 }
 
-func (r *Repository) Delete(ctx context.Context, id string) (err error) {
-	const query = "SELECT oid FROM %s WHERE id = $1"
-	const deleteQuery = "DELETE FROM %s WHERE id = $1"
+// Delete moves document to trash, Purge removes it for good.
+// Login needs write permission on the row as locked, not as cached
+func (r *Repository) Delete(ctx context.Context, login, id, ifMatch string) (err error) {
+	const query = "SELECT " + metaColumns + " FROM %s WHERE id = $1 AND deleted_at IS NULL AND (public OR owner_login = $2 OR grant_logins @> ANY($3::jsonb[]) OR folder_grants @> ANY($3::jsonb[])) FOR UPDATE"
+	const trashQuery = "UPDATE %s SET deleted_at = NOW() WHERE id = $1"
 
-	r.log.Log().Str("id", id).Msg("delete file")
+	r.log.Log().Str("login", login).Str("id", id).Msg("delete file")
 
 	var tx pgx.Tx
 	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
@@ -268,20 +882,16 @@ func (r *Repository) Delete(ctx context.Context, id string) (err error) {
 			_ = tx.Rollback(ctx)
 			panic(p)
 		case err != nil:
-			if errors.Is(err, docs.ErrNoDoc) {
-				return
-			} else {
-				fmt.Fprintf(os.Stderr, "rollback with error: %w", err)
-				err = tx.Rollback(ctx)
+			if !errors.Is(err, docs.ErrNoDoc) && !errors.Is(err, docs.ErrForbidden) && !errors.Is(err, docs.ErrExpired) && !errors.Is(err, docs.ErrPrecondition) {
+				fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
 			}
+			_ = tx.Rollback(ctx)
 		default:
 			err = tx.Commit(ctx)
 		}
 	}()
 
-	var oid int
-
-	err = tx.QueryRow(ctx, r.table(query), id).Scan(&oid)
+	current, err := scanMeta(tx.QueryRow(ctx, r.table(query), id, login, grantPatterns(login, docs.PermissionRead)))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return docs.ErrNoDoc
@@ -289,27 +899,136 @@ func (r *Repository) Delete(ctx context.Context, id string) (err error) {
 		return
 	}
 
-	lb := tx.LargeObjects()
-	err = lb.Unlink(ctx, uint32(oid))
-	if err != nil {
-		return
+	if current.Expired(time.Now()) {
+		return docs.ErrExpired
 	}
 
-	result, err := tx.Exec(ctx, r.table(deleteQuery), id)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			err = docs.ErrNoDoc
-		}
-		return err
+	if !current.Allowed(login, docs.PermissionWrite) {
+		return docs.ErrForbidden
 	}
 
-	if result.RowsAffected() != 1 {
-		return docs.ErrNoDoc
+	if ifMatch != "" && !docs.MatchETag(ifMatch, current.ETag(), false) {
+		return docs.ErrPrecondition
 	}
 
+	_, err = tx.Exec(ctx, r.table(trashQuery), id)
+
 	return
 }
 
 func (r Repository) table(query string) string {
 	return fmt.Sprintf(query, r.tableName)
 }
+
+const metaColumns = "id, blob, sha256, name, file, public, mime, detected_mime, owner_login, created_at, updated_at, grant_logins, size, version, max_versions, revision, schema_name, parent_id, folder_grants, tags, metadata, expires_at"
+
+// scanMeta reads a row selected with metaColumns
+func scanMeta(row pgx.Row) (meta *docs.Meta, err error) {
+	var grant, inherited, tags, metadata []byte
+	var created, updated time.Time
+	var expires *time.Time
+	var key, sum, detected, schema, parent *string
+
+	meta = &docs.Meta{}
+
+	err = row.Scan(&meta.ID, &key, &sum, &meta.Name, &meta.File, &meta.Public, &meta.Mime, &detected, &meta.Owner, &created, &updated, &grant, &meta.Size, &meta.Version, &meta.MaxVersions, &meta.Revision, &schema, &parent, &inherited, &tags, &metadata, &expires)
+	if err != nil {
+		return nil, err
+	}
+
+	if grant != nil {
+		err = json.Unmarshal(grant, &meta.Grant)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(inherited) > 0 && string(inherited) != "[]" {
+		err = json.Unmarshal(inherited, &meta.Inherited)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(tags) > 0 && string(tags) != "[]" {
+		err = json.Unmarshal(tags, &meta.Tags)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(metadata) > 0 && string(metadata) != "{}" {
+		err = json.Unmarshal(metadata, &meta.Metadata)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if key != nil {
+		meta.Blob = *key
+	}
+	if sum != nil {
+		meta.SHA256 = *sum
+	}
+	if detected != nil {
+		meta.Detected = *detected
+	}
+	if schema != nil {
+		meta.Schema = *schema
+	}
+	if parent != nil {
+		meta.ParentID = *parent
+	}
+	if expires != nil {
+		meta.SetExpires(*expires)
+	}
+
+	meta.Created = created.Format(time.DateTime)
+	meta.Updated = updated.Format(time.DateTime)
+	meta.UpdatedTs = updated.UnixNano()
+	meta.Ts = created.UnixNano()
+
+	return
+}
+
+// marshalGrant keeps grant_logins an array, so containment checks never hit null
+func marshalGrant(grant []docs.Grant) ([]byte, error) {
+	if grant == nil {
+		grant = make([]docs.Grant, 0)
+	}
+	return json.Marshal(grant)
+}
+
+// expiry is expires_at of meta, null if it never expires
+func expiry(meta *docs.Meta) *time.Time {
+	if meta.ExpiresTs == 0 {
+		return nil
+	}
+	t := meta.ExpiresAt()
+	return &t
+}
+
+// marshalLabels keeps tags an array and metadata an object for containment checks
+func marshalLabels(meta *docs.Meta) (tags, metadata []byte, err error) {
+	if meta.Tags == nil {
+		tags = []byte("[]")
+	} else if tags, err = json.Marshal(meta.Tags); err != nil {
+		return nil, nil, err
+	}
+
+	if meta.Metadata == nil {
+		metadata = []byte("{}")
+	} else if metadata, err = json.Marshal(meta.Metadata); err != nil {
+		return nil, nil, err
+	}
+
+	return
+}
+
+// grantPatterns lists grant_logins elements giving login at least perm,
+// to be matched with grant_logins @> ANY($n::jsonb[])
+func grantPatterns(login string, perm docs.Permission) []string {
+	patterns := make([]string, 0)
+	for _, p := range perm.Permissions() {
+		pattern, _ := json.Marshal([]docs.Grant{{Login: login, Permission: p}})
+		patterns = append(patterns, string(pattern))
+	}
+	return patterns
+}
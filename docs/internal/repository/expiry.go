@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+)
+
+// Reap removes up to limit expired documents for good, trashed or not,
+// and returns their ids
+func (r *Repository) Reap(ctx context.Context, limit int) (ids []string, err error) {
+	const query = "SELECT id, blob FROM %s WHERE expires_at <= NOW() ORDER BY expires_at LIMIT $1 FOR UPDATE SKIP LOCKED"
+
+	ids, err = r.erase(ctx, r.table(query), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) > 0 {
+		r.log.Log().Int("count", len(ids)).Msg("expired docs reaped")
+	}
+
+	return
+}
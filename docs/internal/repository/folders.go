@@ -0,0 +1,521 @@
+package repository
+
+import (
+	"os"
+	"fmt"
+	"time"
+	"errors"
+	"context"
+	"strings"
+	"encoding/json"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+const folderColumns = "id, owner_login, parent_id, name, path, grant_logins, folder_grants, created_at, updated_at"
+
+// CreateFolder creates folder of its owner inside of parent one,
+// at root if ParentID is empty. Names are unique inside of a folder
+func (r *Repository) CreateFolder(ctx context.Context, folder *docs.Folder) (err error) {
+	const query = "INSERT INTO %s(id, owner_login, parent_id, name, path, grant_logins, folder_grants) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING created_at, updated_at"
+
+	r.log.Log().Str("owner", folder.Owner).Str("parent_id", folder.ParentID).Str("name", folder.Name).Msg("create folder")
+
+	var tx pgx.Tx
+	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		p := recover()
+		switch {
+		case p != nil:
+			_ = tx.Rollback(ctx)
+			panic(p)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
+			_ = tx.Rollback(ctx)
+		default:
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	folder.Path = docs.FolderPath("", folder.Name)
+	folder.Inherited = nil
+	if folder.ParentID != "" {
+		var parent *docs.Folder
+		parent, err = r.ownFolder(ctx, tx, folder.Owner, folder.ParentID)
+		if err != nil {
+			return
+		}
+
+		folder.Path = docs.FolderPath(parent.Path, folder.Name)
+		folder.Inherited = parent.Effective()
+	}
+
+	grant, err := marshalGrant(folder.Grant)
+	if err != nil {
+		return
+	}
+	inherited, err := marshalGrant(folder.Inherited)
+	if err != nil {
+		return
+	}
+
+	var created, updated time.Time
+	err = tx.QueryRow(ctx, r.folders(query), folder.ID, folder.Owner, nullable(folder.ParentID), folder.Name, folder.Path, grant, inherited).Scan(&created, &updated)
+	if err != nil {
+		return folderError(err)
+	}
+
+	folder.Created = created.Format(time.DateTime)
+	folder.Updated = updated.Format(time.DateTime)
+
+	return
+}
+
+func (r *Repository) GetFolder(ctx context.Context, id string) (folder *docs.Folder, err error) {
+	const query = "SELECT " + folderColumns + " FROM %s WHERE id = $1"
+
+	r.log.Log().Str("id", id).Msg("get folder")
+
+	folder, err = scanFolder(r.pool.QueryRow(ctx, r.folders(query), id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, docs.ErrNoFolder
+	}
+
+	return
+}
+
+// ListFolders lists folders inside of parent one,
+// owner folders at root if parentID is empty
+func (r *Repository) ListFolders(ctx context.Context, owner, parentID string) (list []*docs.Folder, err error) {
+	const rootQuery = "SELECT " + folderColumns + " FROM %s WHERE owner_login = $1 AND parent_id IS NULL ORDER BY name"
+	const query = "SELECT " + folderColumns + " FROM %s WHERE parent_id = $1 ORDER BY name"
+
+	r.log.Log().Str("owner", owner).Str("parent_id", parentID).Msg("list folders")
+
+	var rows pgx.Rows
+	if parentID == "" {
+		rows, err = r.pool.Query(ctx, r.folders(rootQuery), owner)
+	} else {
+		rows, err = r.pool.Query(ctx, r.folders(query), parentID)
+	}
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	list = make([]*docs.Folder, 0)
+	for rows.Next() {
+		var folder *docs.Folder
+		folder, err = scanFolder(rows)
+		if err != nil {
+			return
+		}
+
+		list = append(list, folder)
+	}
+
+	err = rows.Err()
+
+	return
+}
+
+// UpdateFolder renames folder and moves it to parentID, nil ones are
+// left as is, empty parentID is root. Folders inside follow, documents
+// inside of moved folder inherit grants of its new place; their ids
+// are returned
+func (r *Repository) UpdateFolder(ctx context.Context, login, id string, name, parentID *string) (folder *docs.Folder, changed []string, err error) {
+	const pathQuery = "UPDATE %s SET path = $3 || substr(path, length($2) + 1) WHERE owner_login = $1 AND (path = $2 OR starts_with(path, $2 || '/'))"
+	const query = "UPDATE %s SET name = $2, parent_id = $3 WHERE id = $1 RETURNING updated_at"
+
+	r.log.Log().Str("login", login).Str("id", id).Msg("update folder")
+
+	var tx pgx.Tx
+	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		p := recover()
+		switch {
+		case p != nil:
+			_ = tx.Rollback(ctx)
+			panic(p)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
+			_ = tx.Rollback(ctx)
+		default:
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	folder, err = r.ownFolder(ctx, tx, login, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	moved := parentID != nil && *parentID != folder.ParentID
+
+	parentPath := folder.Path[:len(folder.Path) - len(folder.Name) - 1]
+	if moved {
+		parentPath = ""
+		folder.Inherited = nil
+		if *parentID != "" {
+			var parent *docs.Folder
+			parent, err = r.ownFolder(ctx, tx, login, *parentID)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// folder can not go inside of itself
+			if parent.ID == folder.ID || strings.HasPrefix(parent.Path, folder.Path + "/") {
+				return nil, nil, fmt.Errorf("%w: folder can not be moved inside of itself", docs.ErrBadFolder)
+			}
+
+			parentPath = parent.Path
+			folder.Inherited = parent.Effective()
+		}
+		folder.ParentID = *parentID
+	}
+	if name != nil {
+		folder.Name = *name
+	}
+
+	path := docs.FolderPath(parentPath, folder.Name)
+	if path != folder.Path {
+		_, err = tx.Exec(ctx, r.folders(pathQuery), login, folder.Path, path)
+		if err != nil {
+			return nil, nil, folderError(err)
+		}
+		folder.Path = path
+	}
+
+	var updated time.Time
+	err = tx.QueryRow(ctx, r.folders(query), id, folder.Name, nullable(folder.ParentID)).Scan(&updated)
+	if err != nil {
+		return nil, nil, err
+	}
+	folder.Updated = updated.Format(time.DateTime)
+
+	if moved {
+		changed, err = r.syncFolders(ctx, tx, folder)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return
+}
+
+// DeleteFolder deletes folder with nothing inside but trash,
+// documents in trash are taken to root
+func (r *Repository) DeleteFolder(ctx context.Context, login, id string) (err error) {
+	const trashQuery = "UPDATE %s SET parent_id = NULL, folder_grants = '[]' WHERE parent_id = $1 AND owner_login = $2 AND deleted_at IS NOT NULL"
+	const query = "DELETE FROM %s WHERE id = $1 AND owner_login = $2"
+
+	r.log.Log().Str("login", login).Str("id", id).Msg("delete folder")
+
+	var tx pgx.Tx
+	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		p := recover()
+		switch {
+		case p != nil:
+			_ = tx.Rollback(ctx)
+			panic(p)
+		case err != nil:
+			if !errors.Is(err, docs.ErrNoFolder) && !errors.Is(err, docs.ErrFolderNotEmpty) {
+				fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
+			}
+			_ = tx.Rollback(ctx)
+		default:
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	_, err = tx.Exec(ctx, r.table(trashQuery), id, login)
+	if err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, r.folders(query), id, login)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" /* foreign key violation */ {
+			return docs.ErrFolderNotEmpty
+		}
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return docs.ErrNoFolder
+	}
+
+	return
+}
+
+func (r *Repository) SetFolderGrant(ctx context.Context, login, id string, grant docs.Grant) (folder *docs.Folder, changed []string, err error) {
+	r.log.Log().Str("login", login).Str("id", id).Str("grantee", grant.Login).Str("permission", string(grant.Permission)).Msg("set folder grant")
+
+	return r.modifyFolderGrants(ctx, login, id, func(folder *docs.Folder) error {
+		if grant.Login == folder.Owner {
+			return docs.ErrBadPermission
+		}
+
+		folder.SetGrant(grant)
+
+		return nil
+	})
+}
+
+func (r *Repository) RevokeFolderGrant(ctx context.Context, login, id, grantee string) (folder *docs.Folder, changed []string, err error) {
+	r.log.Log().Str("login", login).Str("id", id).Str("grantee", grantee).Msg("revoke folder grant")
+
+	return r.modifyFolderGrants(ctx, login, id, func(folder *docs.Folder) error {
+		if !folder.RevokeGrant(grantee) {
+			return docs.ErrNoGrant
+		}
+
+		return nil
+	})
+}
+
+// modifyFolderGrants saves grants of folder changed by modify and passes
+// them down to everything inside, ids of documents inside are returned
+func (r *Repository) modifyFolderGrants(ctx context.Context, login, id string, modify func(folder *docs.Folder) error) (folder *docs.Folder, changed []string, err error) {
+	const selectQuery = "SELECT " + folderColumns + " FROM %s WHERE id = $1 FOR UPDATE"
+	const query = "UPDATE %s SET grant_logins = $2 WHERE id = $1 RETURNING updated_at"
+
+	var tx pgx.Tx
+	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		p := recover()
+		switch {
+		case p != nil:
+			_ = tx.Rollback(ctx)
+			panic(p)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
+			_ = tx.Rollback(ctx)
+		default:
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	folder, err = scanFolder(tx.QueryRow(ctx, r.folders(selectQuery), id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, docs.ErrNoFolder
+		}
+		return nil, nil, err
+	}
+
+	if !folder.Allowed(login, docs.PermissionRead) {
+		return nil, nil, docs.ErrNoFolder
+	}
+	if !folder.Allowed(login, docs.PermissionShare) {
+		return nil, nil, docs.ErrForbidden
+	}
+
+	err = modify(folder)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	grant, err := marshalGrant(folder.Grant)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var updated time.Time
+	err = tx.QueryRow(ctx, r.folders(query), id, grant).Scan(&updated)
+	if err != nil {
+		return nil, nil, err
+	}
+	folder.Updated = updated.Format(time.DateTime)
+
+	changed, err = r.syncFolders(ctx, tx, folder)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return
+}
+
+// syncFolders passes grants of folder down to folders and documents
+// inside, folder itself must have Inherited set already. Ids of
+// documents inside are returned
+func (r *Repository) syncFolders(ctx context.Context, tx pgx.Tx, folder *docs.Folder) (changed []string, err error) {
+	const treeQuery = "WITH RECURSIVE tree AS (SELECT id, parent_id, grant_logins FROM %[1]s WHERE id = $1 " +
+		"UNION ALL SELECT f.id, f.parent_id, f.grant_logins FROM %[1]s f JOIN tree t ON f.parent_id = t.id) SELECT id, parent_id, grant_logins FROM tree"
+	const folderQuery = "UPDATE %s SET folder_grants = $2 WHERE id = $1"
+	const docsQuery = "UPDATE %s SET folder_grants = $2 WHERE parent_id = $1 RETURNING id"
+
+	type node struct {
+		id, parent  string
+		grant       []docs.Grant
+	}
+
+	rows, err := tx.Query(ctx, r.folders(treeQuery), folder.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := make([]node, 0)
+	for rows.Next() {
+		var n node
+		var parent *string
+		var grant []byte
+
+		err = rows.Scan(&n.id, &parent, &grant)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if parent != nil {
+			n.parent = *parent
+		}
+		if err = json.Unmarshal(grant, &n.grant); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		tree = append(tree, n)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// folders come after their parents, grants go top down
+	effective := make(map[string][]docs.Grant, len(tree))
+	changed = make([]string, 0)
+	for _, n := range tree {
+		inherited := folder.Inherited
+		if n.id != folder.ID {
+			inherited = effective[n.parent]
+		}
+		effective[n.id] = docs.MergeGrants(inherited, n.grant)
+
+		var folderGrants, docGrants []byte
+		if folderGrants, err = marshalGrant(inherited); err != nil {
+			return nil, err
+		}
+		if docGrants, err = marshalGrant(effective[n.id]); err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(ctx, r.folders(folderQuery), n.id, folderGrants)
+		if err != nil {
+			return nil, err
+		}
+
+		var docRows pgx.Rows
+		docRows, err = tx.Query(ctx, r.table(docsQuery), n.id, docGrants)
+		if err != nil {
+			return nil, err
+		}
+
+		var ids []string
+		ids, err = pgx.CollectRows(docRows, pgx.RowTo[string])
+		if err != nil {
+			return nil, err
+		}
+		changed = append(changed, ids...)
+	}
+
+	return changed, nil
+}
+
+// folderGrants are grants documents of owner inherit in folder id,
+// none at root. Folder is locked till transaction ends
+func (r *Repository) folderGrants(ctx context.Context, tx pgx.Tx, owner, id string) (grants []docs.Grant, err error) {
+	return inheritedGrants(ctx, tx, r.foldersTableName, owner, id)
+}
+
+// ownFolder locks folder of owner, others are reported missing
+func (r *Repository) ownFolder(ctx context.Context, tx pgx.Tx, owner, id string) (folder *docs.Folder, err error) {
+	return lockFolder(ctx, tx, r.foldersTableName, owner, id)
+}
+
+// inheritedGrants are grants documents of owner inherit in folder id
+// of tableName, none at root. Folder is locked till transaction ends
+func inheritedGrants(ctx context.Context, tx pgx.Tx, tableName, owner, id string) (grants []docs.Grant, err error) {
+	if id == "" {
+		return nil, nil
+	}
+
+	folder, err := lockFolder(ctx, tx, tableName, owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return folder.Effective(), nil
+}
+
+// lockFolder locks folder of owner in tableName, others are reported missing
+func lockFolder(ctx context.Context, tx pgx.Tx, tableName, owner, id string) (folder *docs.Folder, err error) {
+	const query = "SELECT " + folderColumns + " FROM %s WHERE id = $1 AND owner_login = $2 FOR UPDATE"
+
+	folder, err = scanFolder(tx.QueryRow(ctx, fmt.Sprintf(query, tableName), id, owner))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, docs.ErrNoFolder
+	}
+
+	return
+}
+
+// folderError tells name clashes from other failures
+func folderError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" /* unique violation */ {
+		return docs.ErrFolderExists
+	}
+	return err
+}
+
+func (r Repository) folders(query string) string {
+	return fmt.Sprintf(query, r.foldersTableName)
+}
+
+func scanFolder(row pgx.Row) (folder *docs.Folder, err error) {
+	var parent *string
+	var grant, inherited []byte
+	var created, updated time.Time
+
+	folder = &docs.Folder{}
+
+	err = row.Scan(&folder.ID, &folder.Owner, &parent, &folder.Name, &folder.Path, &grant, &inherited, &created, &updated)
+	if err != nil {
+		return nil, err
+	}
+
+	if parent != nil {
+		folder.ParentID = *parent
+	}
+
+	err = json.Unmarshal(grant, &folder.Grant)
+	if err != nil {
+		return nil, err
+	}
+	if string(inherited) != "[]" {
+		err = json.Unmarshal(inherited, &folder.Inherited)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	folder.Created = created.Format(time.DateTime)
+	folder.Updated = updated.Format(time.DateTime)
+
+	return
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+	"context"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+type Links struct {
+	tableName              string
+	pool                  *pgxpool.Pool
+	log                    zerolog.Logger
+}
+
+func NewLinks(log zerolog.Logger, tableName string, pool *pgxpool.Pool) *Links {
+	return &Links{
+		log:                   log,
+		tableName:             tableName,
+		pool:                  pool,
+	}
+}
+
+const linkColumns = "id, doc_id, owner_login, expires_at, max_downloads, downloads, password, revoked, created_at"
+
+func (r *Links) Save(ctx context.Context, link *docs.Link, passwordHash []byte) (err error) {
+	const query = "INSERT INTO %s(id, doc_id, owner_login, expires_at, max_downloads, password) VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at"
+
+	r.log.Log().Str("id", link.ID).Str("doc_id", link.DocID).Msg("save link")
+
+	var maxDownloads *int
+	if link.MaxDownloads > 0 {
+		maxDownloads = &link.MaxDownloads
+	}
+
+	var password *string
+	if passwordHash != nil {
+		hash := string(passwordHash)
+		password = &hash
+	}
+
+	var created time.Time
+	err = r.pool.QueryRow(ctx, r.table(query), link.ID, link.DocID, link.Owner, time.Unix(link.ExpiresTs, 0), maxDownloads, password).Scan(&created)
+	if err != nil {
+		return
+	}
+
+	link.Created = created.Format(time.DateTime)
+	link.Password = password != nil
+
+	return
+}
+
+// Get returns link with password hash, nil if none
+func (r *Links) Get(ctx context.Context, id string) (link *docs.Link, passwordHash []byte, err error) {
+	const query = "SELECT " + linkColumns + " FROM %s WHERE id = $1"
+
+	link, passwordHash, err = scanLink(r.pool.QueryRow(ctx, r.table(query), id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = docs.ErrNoLink
+		}
+		return nil, nil, err
+	}
+
+	return
+}
+
+func (r *Links) List(ctx context.Context, docID string) (list []*docs.Link, err error) {
+	const query = "SELECT " + linkColumns + " FROM %s WHERE doc_id = $1 ORDER BY created_at DESC"
+
+	rows, err := r.pool.Query(ctx, r.table(query), docID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	list = make([]*docs.Link, 0)
+	for rows.Next() {
+		var link *docs.Link
+		link, _, err = scanLink(rows)
+		if err != nil {
+			return
+		}
+
+		list = append(list, link)
+	}
+
+	err = rows.Err()
+
+	return
+}
+
+// Use counts one download, fails if link is revoked,
+// expired or has no downloads left
+func (r *Links) Use(ctx context.Context, id string) (err error) {
+	const query = "UPDATE %s SET downloads = downloads + 1 WHERE id = $1 AND NOT revoked AND expires_at > NOW() AND (max_downloads IS NULL OR downloads < max_downloads)"
+
+	result, err := r.pool.Exec(ctx, r.table(query), id)
+	if err != nil {
+		return
+	}
+
+	if result.RowsAffected() != 1 {
+		return docs.ErrLinkExpired
+	}
+
+	return
+}
+
+func (r *Links) Revoke(ctx context.Context, docID, id string) (err error) {
+	const query = "UPDATE %s SET revoked = true WHERE id = $1 AND doc_id = $2"
+
+	r.log.Log().Str("id", id).Str("doc_id", docID).Msg("revoke link")
+
+	result, err := r.pool.Exec(ctx, r.table(query), id, docID)
+	if err != nil {
+		return
+	}
+
+	if result.RowsAffected() != 1 {
+		return docs.ErrNoLink
+	}
+
+	return
+}
+
+func (r Links) table(query string) string {
+	return fmt.Sprintf(query, r.tableName)
+}
+
+func scanLink(row pgx.Row) (link *docs.Link, passwordHash []byte, err error) {
+	var expires, created time.Time
+	var maxDownloads *int
+	var password *string
+
+	link = &docs.Link{}
+
+	err = row.Scan(&link.ID, &link.DocID, &link.Owner, &expires, &maxDownloads, &link.Downloads, &password, &link.Revoked, &created)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if maxDownloads != nil {
+		link.MaxDownloads = *maxDownloads
+	}
+
+	if password != nil {
+		link.Password = true
+		passwordHash = []byte(*password)
+	}
+
+	link.Expires = expires.Format(time.DateTime)
+	link.ExpiresTs = expires.Unix()
+	link.Created = created.Format(time.DateTime)
+
+	return
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"io"
+	"bytes"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// sniffMime reads head of r to detect content type, returned
+// reader yields head and the rest of r
+func sniffMime(r io.Reader, name string) (detected string, content io.Reader, err error) {
+	head := make([]byte, docs.SniffLen)
+
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	head = head[:n]
+
+	return docs.DetectMime(head, name), io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// nullable stores empty string as NULL
+func nullable(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
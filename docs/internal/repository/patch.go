@@ -0,0 +1,557 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"time"
+	"bytes"
+	"errors"
+	"context"
+	"strconv"
+	"strings"
+	"math/big"
+	"encoding/json"
+	"github.com/jackc/pgx/v5"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// Patch applies json patch or merge patch, as kind tells, to json
+// document. Patched content replaces current one, as Update does
+func (r *Repository) Patch(ctx context.Context, login, id, ifMatch, kind string, patch []byte) (meta *docs.Meta, jsonData []byte, err error) {
+	const selectQuery = "SELECT " + metaColumns + ", json FROM %s WHERE id = $1 AND deleted_at IS NULL AND (public OR owner_login = $2 OR grant_logins @> ANY($3::jsonb[]) OR folder_grants @> ANY($3::jsonb[])) FOR UPDATE"
+	const query = "UPDATE %s SET json = $2, size = $3, content_text = $4, version = version + 1, revision = revision + 1, updated_at = NOW() WHERE id = $1 RETURNING updated_at, version, revision"
+
+	r.log.Log().Str("login", login).Str("id", id).Str("kind", kind).Msg("patch doc")
+
+	var released []string
+	defer func() {
+		settleBlobs(ctx, r.log, r.blobs, err, nil, released)
+	}()
+
+	var tx pgx.Tx
+	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		p := recover()
+		switch {
+		case p != nil:
+			_ = tx.Rollback(ctx)
+			panic(p)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
+			_ = tx.Rollback(ctx)
+		default:
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	var current []byte
+	meta, err = scanMeta(&jsonRow{row: tx.QueryRow(ctx, r.table(selectQuery), id, login, grantPatterns(login, docs.PermissionRead)), json: &current})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, docs.ErrNoDoc
+		}
+		return nil, nil, err
+	}
+
+	if meta.Expired(time.Now()) {
+		return nil, nil, docs.ErrExpired
+	}
+
+	if !meta.Allowed(login, docs.PermissionWrite) {
+		return nil, nil, docs.ErrForbidden
+	}
+
+	if ifMatch != "" && !docs.MatchETag(ifMatch, meta.ETag(), false) {
+		return nil, nil, docs.ErrPrecondition
+	}
+
+	if meta.File {
+		return nil, nil, docs.ErrNotJSON
+	}
+
+	switch kind {
+	case docs.PatchJSON:
+		jsonData, err = applyJSONPatch(current, patch, r.maxJSONSize)
+	case docs.PatchMerge:
+		jsonData, err = applyMergePatch(current, patch, r.maxJSONSize)
+	default:
+		err = fmt.Errorf("%w: unknown patch type %q", docs.ErrBadPatch, kind)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = r.validate(ctx, tx, meta.Owner, meta.Schema, jsonData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = r.archive(ctx, tx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	size := int64(len(jsonData))
+
+	var updated time.Time
+	err = tx.QueryRow(ctx, r.table(query), id, jsonData, size, contentText(nil, jsonData)).Scan(&updated, &meta.Version, &meta.Revision)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	released, err = r.prune(ctx, tx, id, meta.MaxVersions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meta.Size = size
+	meta.Updated = updated.Format(time.DateTime)
+	meta.UpdatedTs = updated.UnixNano()
+
+	return
+}
+
+// jsonRow scans json content following metaColumns
+type jsonRow struct {
+	row   pgx.Row
+	json  *[]byte
+}
+
+func (j *jsonRow) Scan(dest ...interface{}) error {
+	return j.row.Scan(append(dest, j.json)...)
+}
+
+// patchOp is an operation of json patch, Value is nil if absent
+type patchOp struct {
+	Op     string           `json:"op"`
+	Path   *string          `json:"path"`
+	From   *string          `json:"from"`
+	Value  json.RawMessage  `json:"value"`
+}
+
+// applyJSONPatch applies operations of patch in order, RFC 6902.
+// Any failing operation fails the whole patch. Size counts the
+// document and every value added or copied, removed ones are not
+// subtracted, so copies can not grow document or work past limit
+func applyJSONPatch(current, patch []byte, limit int64) (result []byte, err error) {
+	var ops []patchOp
+	if err = json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: patch must be an array of operations", docs.ErrBadPatch)
+	}
+
+	doc, err := decodeJSON(current)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(len(current))
+	for i, op := range ops {
+		var added int64
+		doc, added, err = applyOp(doc, op, limit - size)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+		size += added
+	}
+
+	return encodeLimited(doc, limit)
+}
+
+// applyOp returns patched doc and size of value added, it fails
+// with ErrFileTooLarge before adding value larger than room
+func applyOp(doc interface{}, op patchOp, room int64) (interface{}, int64, error) {
+	if op.Path == nil {
+		return nil, 0, fmt.Errorf("%w: no path", docs.ErrBadPatch)
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var value interface{}
+	var added int64
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, 0, fmt.Errorf("%w: %s needs value", docs.ErrBadPatch, op.Op)
+		}
+		if value, err = decodeJSON(op.Value); err != nil {
+			return nil, 0, err
+		}
+		if op.Op != "test" {
+			added = int64(len(op.Value))
+		}
+	case "move", "copy":
+		if op.From == nil {
+			return nil, 0, fmt.Errorf("%w: %s needs from", docs.ErrBadPatch, op.Op)
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, 0, err
+		}
+		if op.Op == "move" && len(from) < len(path) && isPrefix(from, path) {
+			return nil, 0, fmt.Errorf("%w: can not move %s into itself", docs.ErrPatchConflict, *op.From)
+		}
+		if value, err = pointerGet(doc, from); err != nil {
+			return nil, 0, err
+		}
+		if op.Op == "move" {
+			if doc, err = pointerUpdate(doc, from, removeAt); err != nil {
+				return nil, 0, err
+			}
+		} else {
+			// sized before cloning, too large copies fail without the work
+			if added = jsonSize(value, room); added <= room {
+				value = cloneJSON(value)
+			}
+		}
+	}
+
+	if added > room {
+		return nil, 0, fmt.Errorf("%w: patched document is too large", docs.ErrFileTooLarge)
+	}
+
+	switch op.Op {
+	case "add", "move", "copy":
+		doc, err = pointerUpdate(doc, path, addAt(value))
+		return doc, added, err
+	case "remove":
+		doc, err = pointerUpdate(doc, path, removeAt)
+		return doc, 0, err
+	case "replace":
+		doc, err = pointerUpdate(doc, path, replaceAt(value))
+		return doc, added, err
+	case "test":
+		current, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !equalJSON(current, value) {
+			return nil, 0, fmt.Errorf("%w: test of %s failed", docs.ErrPatchConflict, *op.Path)
+		}
+		return doc, 0, nil
+	}
+
+	return nil, 0, fmt.Errorf("%w: unknown op %q", docs.ErrBadPatch, op.Op)
+}
+
+// applyMergePatch merges patch into current, RFC 7396. Merged
+// document is at most current and patch together, limit is checked
+// once encoded
+func applyMergePatch(current, patch []byte, limit int64) (result []byte, err error) {
+	doc, err := decodeJSON(current)
+	if err != nil {
+		return nil, err
+	}
+
+	merge, err := decodeJSON(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeLimited(mergeJSON(doc, merge), limit)
+}
+
+func mergeJSON(target, patch interface{}) interface{} {
+	fields, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	result, ok := target.(map[string]interface{})
+	if !ok {
+		result = make(map[string]interface{})
+	}
+
+	for key, value := range fields {
+		if value == nil {
+			delete(result, key)
+		} else {
+			result[key] = mergeJSON(result[key], value)
+		}
+	}
+
+	return result
+}
+
+// parsePointer splits json pointer into reference tokens, RFC 6901
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: bad pointer %q", docs.ErrBadPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: no member %q", docs.ErrPatchConflict, token)
+			}
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("%w: %q of a scalar", docs.ErrPatchConflict, token)
+		}
+	}
+	return doc, nil
+}
+
+// documentRoot is parent of the whole document
+type documentRoot struct{}
+
+// pointerUpdate rebuilds doc with value at path changed by modify,
+// which is given the parent container and the last token
+func pointerUpdate(doc interface{}, path []string, modify func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 0 {
+		return modify(documentRoot{}, "")
+	}
+	if len(path) == 1 {
+		return modify(doc, path[0])
+	}
+
+	child, err := pointerGet(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+
+	child, err = pointerUpdate(child, path[1:], modify)
+	if err != nil {
+		return nil, err
+	}
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		node[path[0]] = child
+	case []interface{}:
+		i, _ := arrayIndex(path[0], len(node), false)
+		node[i] = child
+	}
+	return doc, nil
+}
+
+// addAt adds value to parent, replaces member of object or
+// inserts into array
+func addAt(value interface{}) func(parent interface{}, token string) (interface{}, error) {
+	return func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case documentRoot:
+			return value, nil
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+		return nil, fmt.Errorf("%w: can not add to a scalar", docs.ErrPatchConflict)
+	}
+}
+
+func replaceAt(value interface{}) func(parent interface{}, token string) (interface{}, error) {
+	return func(parent interface{}, token string) (interface{}, error) {
+		if _, root := parent.(documentRoot); !root {
+			if _, err := pointerGet(parent, []string{token}); err != nil {
+				return nil, err
+			}
+		}
+		return addAt(value)(parent, token)
+	}
+}
+
+func removeAt(parent interface{}, token string) (interface{}, error) {
+	switch node := parent.(type) {
+	case documentRoot:
+		return nil, fmt.Errorf("%w: can not remove document", docs.ErrPatchConflict)
+	case map[string]interface{}:
+		if _, ok := node[token]; !ok {
+			return nil, fmt.Errorf("%w: no member %q", docs.ErrPatchConflict, token)
+		}
+		delete(node, token)
+		return node, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		return append(node[:i:i], node[i+1:]...), nil
+	}
+	return nil, fmt.Errorf("%w: can not remove from a scalar", docs.ErrPatchConflict)
+}
+
+// arrayIndex parses array index token, "-" is the end of array
+// which only addition may point at
+func arrayIndex(token string, length int, end bool) (int, error) {
+	if token == "-" && end {
+		return length, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("%w: bad index %q", docs.ErrPatchConflict, token)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i > length || (i == length && !end) {
+		return 0, fmt.Errorf("%w: index %s out of range", docs.ErrPatchConflict, token)
+	}
+	return i, nil
+}
+
+// decodeJSON keeps numbers as they are written
+func decodeJSON(data []byte) (value interface{}, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err = decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("%w: bad json", docs.ErrBadPatch)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("%w: trailing data after json", docs.ErrBadPatch)
+	}
+	return value, nil
+}
+
+func encodeJSON(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// encodeLimited encodes patched document, failing with
+// ErrFileTooLarge if it is over limit bytes
+func encodeLimited(value interface{}, limit int64) ([]byte, error) {
+	result, err := encodeJSON(value)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(result)) > limit {
+		return nil, fmt.Errorf("%w: patched document is %d bytes, limit is %d", docs.ErrFileTooLarge, len(result), limit)
+	}
+	return result, nil
+}
+
+// jsonSize estimates encoded size of value, escapes aside,
+// counting stops once it is past limit
+func jsonSize(value interface{}, limit int64) (size int64) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		size = 2
+		for key, item := range v {
+			size += int64(len(key)) + 4 + jsonSize(item, limit - size)
+			if size > limit {
+				return size
+			}
+		}
+	case []interface{}:
+		size = 2
+		for _, item := range v {
+			size += 1 + jsonSize(item, limit - size)
+			if size > limit {
+				return size
+			}
+		}
+	case string:
+		size = int64(len(v)) + 2
+	case json.Number:
+		size = int64(len(v))
+	case bool:
+		size = 5
+	default:
+		size = 4
+	}
+	return size
+}
+
+func cloneJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = cloneJSON(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = cloneJSON(item)
+		}
+		return result
+	}
+	return value
+}
+
+// equalJSON compares values as json does, 1 and 1.0 are equal
+func equalJSON(a, b interface{}) bool {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, item := range x {
+			other, ok := y[key]
+			if !ok || !equalJSON(item, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalJSON(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		m, okM := new(big.Rat).SetString(x.String())
+		n, okN := new(big.Rat).SetString(y.String())
+		return okM && okN && m.Cmp(n) == 0
+	}
+	return a == b
+}
@@ -0,0 +1,279 @@
+package repository
+
+import (
+	"fmt"
+	"errors"
+	"strings"
+	"testing"
+	"reflect"
+	"encoding/json"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// testJSONSize is size limit of patched documents in tests
+const testJSONSize = 1 << 20
+
+// sameJSON compares documents by value, member order aside
+func sameJSON(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+
+	var a, b interface{}
+	if err := json.Unmarshal(got, &a); err != nil {
+		t.Fatalf("result %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &b); err != nil {
+		t.Fatalf("expected %s: %v", want, err)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// TestJSONPatch runs examples of RFC 6902 appendix A and a few more,
+// want is empty when patch must fail with err
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		doc    string
+		patch  string
+		want   string
+		err    error
+	}{
+		{"A.1 add object member",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/baz","value":"qux"}]`,
+			`{"baz":"qux","foo":"bar"}`, nil},
+		{"A.2 add array element",
+			`{"foo":["bar","baz"]}`,
+			`[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			`{"foo":["bar","qux","baz"]}`, nil},
+		{"A.3 remove object member",
+			`{"baz":"qux","foo":"bar"}`,
+			`[{"op":"remove","path":"/baz"}]`,
+			`{"foo":"bar"}`, nil},
+		{"A.4 remove array element",
+			`{"foo":["bar","qux","baz"]}`,
+			`[{"op":"remove","path":"/foo/1"}]`,
+			`{"foo":["bar","baz"]}`, nil},
+		{"A.5 replace value",
+			`{"baz":"qux","foo":"bar"}`,
+			`[{"op":"replace","path":"/baz","value":"boo"}]`,
+			`{"baz":"boo","foo":"bar"}`, nil},
+		{"A.6 move value",
+			`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, nil},
+		{"A.7 move array element",
+			`{"foo":["all","grass","cows","eat"]}`,
+			`[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			`{"foo":["all","cows","eat","grass"]}`, nil},
+		{"A.8 test value success",
+			`{"baz":"qux","foo":["a",2,"c"]}`,
+			`[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`, nil},
+		{"A.9 test value error",
+			`{"baz":"qux"}`,
+			`[{"op":"test","path":"/baz","value":"bar"}]`,
+			"", docs.ErrPatchConflict},
+		{"A.10 add nested member object",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+			`{"foo":"bar","child":{"grandchild":{}}}`, nil},
+		{"A.11 ignore unrecognized elements",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/baz","value":"qux","xyz":123}]`,
+			`{"foo":"bar","baz":"qux"}`, nil},
+		{"A.12 add to nonexistent target",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			"", docs.ErrPatchConflict},
+		{"A.14 escape ordering",
+			`{"/":9,"~1":10}`,
+			`[{"op":"test","path":"/~01","value":10}]`,
+			`{"/":9,"~1":10}`, nil},
+		{"A.15 comparing strings and numbers",
+			`{"/":9,"~1":10}`,
+			`[{"op":"test","path":"/~01","value":"10"}]`,
+			"", docs.ErrPatchConflict},
+		{"A.16 add array value",
+			`{"foo":["bar"]}`,
+			`[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			`{"foo":["bar",["abc","def"]]}`, nil},
+		{"copy is independent",
+			`{"a":{"b":1}}`,
+			`[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`,
+			`{"a":{"b":1},"c":{"b":2}}`, nil},
+		{"replace document",
+			`{"a":1}`,
+			`[{"op":"replace","path":"","value":[1]}]`,
+			`[1]`, nil},
+		{"add null value",
+			`{}`,
+			`[{"op":"add","path":"/a","value":null}]`,
+			`{"a":null}`, nil},
+		{"numbers compared by value",
+			`{"a":1.0}`,
+			`[{"op":"test","path":"/a","value":1}]`,
+			`{"a":1}`, nil},
+		{"failing operation fails patch",
+			`{"a":1}`,
+			`[{"op":"remove","path":"/a"},{"op":"remove","path":"/a"}]`,
+			"", docs.ErrPatchConflict},
+		{"replace missing member",
+			`{"a":1}`,
+			`[{"op":"replace","path":"/b","value":2}]`,
+			"", docs.ErrPatchConflict},
+		{"remove document",
+			`{"a":1}`,
+			`[{"op":"remove","path":""}]`,
+			"", docs.ErrPatchConflict},
+		{"move into itself",
+			`{"a":{"b":1}}`,
+			`[{"op":"move","from":"/a","path":"/a/c"}]`,
+			"", docs.ErrPatchConflict},
+		{"index with leading zero",
+			`{"a":[1,2]}`,
+			`[{"op":"remove","path":"/a/01"}]`,
+			"", docs.ErrPatchConflict},
+		{"index past end",
+			`{"a":[1,2]}`,
+			`[{"op":"add","path":"/a/3","value":3}]`,
+			"", docs.ErrPatchConflict},
+		{"end of array only for add",
+			`{"a":[1,2]}`,
+			`[{"op":"remove","path":"/a/-"}]`,
+			"", docs.ErrPatchConflict},
+		{"unknown op",
+			`{}`,
+			`[{"op":"merge","path":"/a","value":1}]`,
+			"", docs.ErrBadPatch},
+		{"missing value",
+			`{}`,
+			`[{"op":"add","path":"/a"}]`,
+			"", docs.ErrBadPatch},
+		{"missing path",
+			`{}`,
+			`[{"op":"add","value":1}]`,
+			"", docs.ErrBadPatch},
+		{"bad pointer",
+			`{}`,
+			`[{"op":"add","path":"a","value":1}]`,
+			"", docs.ErrBadPatch},
+		{"not an array",
+			`{}`,
+			`{"op":"add","path":"/a","value":1}`,
+			"", docs.ErrBadPatch},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := applyJSONPatch([]byte(test.doc), []byte(test.patch), testJSONSize)
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("error %v, want %v", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameJSON(t, got, test.want) {
+				t.Errorf("patched %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestJSONPatchKeepsNumbers(t *testing.T) {
+	got, err := applyJSONPatch([]byte(`{"a":1.0}`), []byte(`[{"op":"add","path":"/b","value":12345678901234567890}]`), testJSONSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"a":1.0,"b":12345678901234567890}` {
+		t.Errorf("patched %s, numbers changed", got)
+	}
+}
+
+// TestJSONPatchSize copies the whole document into itself over and
+// over, document doubles with every copy and must fail early
+func TestJSONPatchSize(t *testing.T) {
+	ops := make([]string, 64)
+	for i := range ops {
+		ops[i] = fmt.Sprintf(`{"op":"copy","from":"","path":"/%d"}`, i)
+	}
+	patch := []byte("[" + strings.Join(ops, ",") + "]")
+
+	_, err := applyJSONPatch([]byte(`{"a":"0123456789"}`), patch, testJSONSize)
+	if !errors.Is(err, docs.ErrFileTooLarge) {
+		t.Errorf("doubling copies: %v, want ErrFileTooLarge", err)
+	}
+
+	tests := []struct {
+		name   string
+		doc    string
+		patch  string
+		limit  int64
+		err    error
+	}{
+		{"fits", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, 16, nil},
+		{"added value too large", `{"a":1}`, `[{"op":"add","path":"/b","value":"0123456789"}]`, 16, docs.ErrFileTooLarge},
+		{"copy too large", `{"a":"0123456789"}`, `[{"op":"copy","from":"/a","path":"/b"}]`, 24, docs.ErrFileTooLarge},
+		{"removed values still count", `{"a":"0123456789"}`, `[{"op":"remove","path":"/a"},{"op":"add","path":"/b","value":"0123456789"}]`, 24, docs.ErrFileTooLarge},
+		{"move does not grow", `{"a":"0123456789"}`, `[{"op":"move","from":"/a","path":"/b"}]`, 18, nil},
+		{"document over limit", `{"a":"0123456789"}`, `[{"op":"test","path":"/a","value":"0123456789"}]`, 10, docs.ErrFileTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := applyJSONPatch([]byte(test.doc), []byte(test.patch), test.limit)
+			if !errors.Is(err, test.err) {
+				t.Errorf("error %v, want %v", err, test.err)
+			}
+		})
+	}
+
+	_, err = applyMergePatch([]byte(`{"a":1}`), []byte(`{"b":"0123456789"}`), 16)
+	if !errors.Is(err, docs.ErrFileTooLarge) {
+		t.Errorf("merged over limit: %v, want ErrFileTooLarge", err)
+	}
+}
+
+// TestMergePatch runs examples of RFC 7396 appendix A
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc    string
+		patch  string
+		want   string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.doc+" "+test.patch, func(t *testing.T) {
+			got, err := applyMergePatch([]byte(test.doc), []byte(test.patch), testJSONSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameJSON(t, got, test.want) {
+				t.Errorf("merged %s, want %s", got, test.want)
+			}
+		})
+	}
+
+	_, err := applyMergePatch([]byte(`{}`), []byte(`{"a":`), testJSONSize)
+	if !errors.Is(err, docs.ErrBadPatch) {
+		t.Errorf("bad merge patch: %v, want ErrBadPatch", err)
+	}
+}
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"os"
+	"fmt"
+	"time"
+	"errors"
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/bd878/doc_server/docs/internal/jsonschema"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+const schemaColumns = "owner_login, name, schema, is_default, created_at, updated_at"
+
+// SaveSchema creates or replaces owner schema of the name, default one
+// stops being default for others. Documents are not validated again
+func (r *Repository) SaveSchema(ctx context.Context, schema *docs.Schema) (err error) {
+	const resetQuery = "UPDATE %s SET is_default = false WHERE owner_login = $1 AND name <> $2 AND is_default"
+	const query = "INSERT INTO %s(owner_login, name, schema, is_default) VALUES ($1, $2, $3, $4) " +
+		"ON CONFLICT (owner_login, name) DO UPDATE SET schema = EXCLUDED.schema, is_default = EXCLUDED.is_default RETURNING created_at, updated_at"
+
+	r.log.Log().Str("owner", schema.Owner).Str("name", schema.Name).Bool("default", schema.Default).Msg("save schema")
+
+	var tx pgx.Tx
+	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		p := recover()
+		switch {
+		case p != nil:
+			_ = tx.Rollback(ctx)
+			panic(p)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
+			_ = tx.Rollback(ctx)
+		default:
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	if schema.Default {
+		_, err = tx.Exec(ctx, r.schemas(resetQuery), schema.Owner, schema.Name)
+		if err != nil {
+			return
+		}
+	}
+
+	var created, updated time.Time
+	err = tx.QueryRow(ctx, r.schemas(query), schema.Owner, schema.Name, []byte(schema.Schema), schema.Default).Scan(&created, &updated)
+	if err != nil {
+		return
+	}
+
+	schema.Created = created.Format(time.DateTime)
+	schema.Updated = updated.Format(time.DateTime)
+
+	return
+}
+
+func (r *Repository) ListSchemas(ctx context.Context, owner string) (list []*docs.Schema, err error) {
+	const query = "SELECT " + schemaColumns + " FROM %s WHERE owner_login = $1 ORDER BY name"
+
+	r.log.Log().Str("owner", owner).Msg("list schemas")
+
+	rows, err := r.pool.Query(ctx, r.schemas(query), owner)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	list = make([]*docs.Schema, 0)
+	for rows.Next() {
+		var schema *docs.Schema
+		schema, err = scanSchema(rows)
+		if err != nil {
+			return
+		}
+
+		list = append(list, schema)
+	}
+
+	err = rows.Err()
+
+	return
+}
+
+func (r *Repository) GetSchema(ctx context.Context, owner, name string) (schema *docs.Schema, err error) {
+	const query = "SELECT " + schemaColumns + " FROM %s WHERE owner_login = $1 AND name = $2"
+
+	r.log.Log().Str("owner", owner).Str("name", name).Msg("get schema")
+
+	schema, err = scanSchema(r.pool.QueryRow(ctx, r.schemas(query), owner, name))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, docs.ErrNoSchema
+	}
+
+	return
+}
+
+// DeleteSchema deletes schema no document names
+func (r *Repository) DeleteSchema(ctx context.Context, owner, name string) (err error) {
+	const query = "DELETE FROM %s WHERE owner_login = $1 AND name = $2"
+
+	r.log.Log().Str("owner", owner).Str("name", name).Msg("delete schema")
+
+	tag, err := r.pool.Exec(ctx, r.schemas(query), owner, name)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" /* foreign key violation */ {
+			return docs.ErrSchemaInUse
+		}
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return docs.ErrNoSchema
+	}
+
+	return
+}
+
+// validate checks json content of owner document against schema
+// of the name, or owner default schema if name is empty. Content
+// is valid if owner has no default schema
+func (r *Repository) validate(ctx context.Context, tx pgx.Tx, owner, name string, jsonData []byte) (err error) {
+	const query = "SELECT name, schema FROM %s WHERE owner_login = $1 AND (name = $2 OR ($2 = '' AND is_default))"
+
+	var raw []byte
+	err = tx.QueryRow(ctx, r.schemas(query), owner, name).Scan(&name, &raw)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			if name == "" {
+				return nil
+			}
+			return docs.ErrNoSchema
+		}
+		return err
+	}
+
+	schema, err := jsonschema.Compile(raw)
+	if err != nil {
+		return err
+	}
+
+	violations, err := schema.Validate(jsonData)
+	if err != nil {
+		return err
+	}
+
+	if len(violations) > 0 {
+		return &docs.SchemaError{Schema: name, Violations: violations}
+	}
+
+	return nil
+}
+
+func (r Repository) schemas(query string) string {
+	return fmt.Sprintf(query, r.schemasTableName)
+}
+
+func scanSchema(row pgx.Row) (schema *docs.Schema, err error) {
+	var raw []byte
+	var created, updated time.Time
+
+	schema = &docs.Schema{}
+
+	err = row.Scan(&schema.Owner, &schema.Name, &raw, &schema.Default, &created, &updated)
+	if err != nil {
+		return nil, err
+	}
+
+	schema.Schema = raw
+	schema.Created = created.Format(time.DateTime)
+	schema.Updated = updated.Format(time.DateTime)
+
+	return
+}
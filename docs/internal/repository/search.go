@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"io"
+	"fmt"
+	"sort"
+	"bytes"
+	"context"
+	"html"
+	"strings"
+	"encoding/json"
+	"github.com/jackc/pgx/v5"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// searchTextLen bounds text kept per document for search. Tsvector
+// made of it must fit 1 MB limit of Postgres, with positions and entry
+// headers short distinct words take about 4 times their text
+const searchTextLen = 1 << 17 /* 128 KB */
+
+// searchText keeps head of text content while it is streamed
+type searchText struct {
+	buf bytes.Buffer
+}
+
+func (s *searchText) Write(p []byte) (n int, err error) {
+	if rest := searchTextLen - s.buf.Len(); rest > 0 {
+		if len(p) < rest {
+			rest = len(p)
+		}
+		s.buf.Write(p[:rest])
+	}
+	return len(p), nil
+}
+
+// value is text fit for a text column, nil if nothing was kept
+func (s *searchText) value() *string {
+	if s == nil || s.buf.Len() == 0 {
+		return nil
+	}
+	return nullable(cleanText(s.buf.String()))
+}
+
+// captureText tees content of text types into searchText,
+// other content is not searchable
+func captureText(detected string, content io.Reader) (io.Reader, *searchText) {
+	if !docs.TextMime(detected) {
+		return content, nil
+	}
+
+	text := &searchText{}
+	return io.TeeReader(content, text), text
+}
+
+// contentText is searchable text of a document, file
+// text if it was kept or words of json document
+func contentText(text *searchText, jsonData []byte) *string {
+	if text != nil {
+		return text.value()
+	}
+	if len(jsonData) > 0 {
+		return jsonText(jsonData)
+	}
+	return nil
+}
+
+// jsonText lists keys and string values of json document
+func jsonText(jsonData []byte) *string {
+	var value interface{}
+	if err := json.Unmarshal(jsonData, &value); err != nil {
+		return nil
+	}
+
+	words := make([]string, 0)
+
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case string:
+			words = append(words, v)
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				words = append(words, key)
+				walk(v[key])
+			}
+		}
+	}
+	walk(value)
+
+	text := strings.Join(words, "\n")
+	if len(text) > searchTextLen {
+		text = text[:searchTextLen]
+	}
+
+	return nullable(cleanText(text))
+}
+
+// cleanText makes text acceptable to postgres, which
+// rejects invalid utf-8 and zero bytes
+func cleanText(text string) string {
+	return strings.ReplaceAll(strings.ToValidUTF8(text, ""), "\x00", "")
+}
+
+// snippetStart and snippetStop delimit matches in ts_headline output,
+// they are not html so content can not forge markup
+const (
+	snippetStart = "\x02"
+	snippetStop  = "\x03"
+)
+
+// markSnippet html-escapes headline and puts matches in <mark></mark>,
+// stray delimiters coming from content are balanced or dropped
+func markSnippet(headline string) string {
+	var b strings.Builder
+	marked := false
+	for headline != "" {
+		i := strings.IndexAny(headline, snippetStart+snippetStop)
+		if i < 0 {
+			b.WriteString(html.EscapeString(headline))
+			break
+		}
+
+		b.WriteString(html.EscapeString(headline[:i]))
+		switch {
+		case headline[i:i+1] == snippetStart && !marked:
+			b.WriteString("<mark>")
+			marked = true
+		case headline[i:i+1] == snippetStop && marked:
+			b.WriteString("</mark>")
+			marked = false
+		}
+		headline = headline[i+1:]
+	}
+	if marked {
+		b.WriteString("</mark>")
+	}
+	return b.String()
+}
+
+// Search finds documents login owns or is granted by words of text,
+// best ranked first. Snippets are html, escaped text with matches in <mark></mark>
+func (r *Repository) Search(ctx context.Context, login, text string, limit int) (results []*docs.SearchResult, err error) {
+	const query = "SELECT %[2]s, rank, ts_headline('simple', name || E'\\n' || COALESCE(content_text, ''), query, 'MaxFragments=2, MinWords=5, MaxWords=20, StartSel=' || chr(2) || ', StopSel=' || chr(3)) " +
+		"FROM (SELECT %[2]s, content_text, query, ts_rank_cd(search, query) AS rank FROM %[1]s, websearch_to_tsquery('simple', $1) AS query " +
+		"WHERE search @@ query AND deleted_at IS NULL AND (expires_at IS NULL OR expires_at > NOW()) AND (owner_login = $2 OR grant_logins @> ANY($3::jsonb[]) OR folder_grants @> ANY($3::jsonb[])) ORDER BY rank DESC, updated_at DESC, id LIMIT $4) AS found " +
+		"ORDER BY rank DESC, updated_at DESC, id"
+
+	r.log.Log().Str("login", login).Str("text", text).Int("limit", limit).Msg("search docs")
+
+	rows, err := r.pool.Query(ctx, fmt.Sprintf(query, r.tableName, metaColumns), text, login, grantPatterns(login, docs.PermissionRead), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results = make([]*docs.SearchResult, 0)
+	for rows.Next() {
+		result := &docs.SearchResult{}
+
+		result.Doc, err = scanMeta(&searchRow{row: rows, rank: &result.Rank, snippet: &result.Snippet})
+		if err != nil {
+			return nil, err
+		}
+		result.Snippet = markSnippet(result.Snippet)
+
+		results = append(results, result)
+	}
+
+	err = rows.Err()
+
+	return
+}
+
+// searchRow scans rank and snippet following metaColumns
+type searchRow struct {
+	row      pgx.Row
+	rank     *float32
+	snippet  *string
+}
+
+func (s *searchRow) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.rank, s.snippet)...)
+}
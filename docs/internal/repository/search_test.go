@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"testing"
+)
+
+func TestMarkSnippet(t *testing.T) {
+	tests := []struct {
+		name      string
+		headline  string
+		want      string
+	}{
+		{"plain", "no matches", "no matches"},
+		{"match", "find \x02word\x03 here", "find <mark>word</mark> here"},
+		{"several", "\x02a\x03 b \x02c\x03", "<mark>a</mark> b <mark>c</mark>"},
+		{"markup escaped", "<script>\x02alert\x03(1)</script>", "&lt;script&gt;<mark>alert</mark>(1)&lt;/script&gt;"},
+		{"content mark escaped", "<mark>x</mark>", "&lt;mark&gt;x&lt;/mark&gt;"},
+		{"quotes escaped", "a=\"b\" 'c' & d", "a=&#34;b&#34; &#39;c&#39; &amp; d"},
+		{"unclosed", "\x02word", "<mark>word</mark>"},
+		{"stray stop", "word\x03 \x03", "word "},
+		{"nested start", "\x02a\x02b\x03", "<mark>ab</mark>"},
+		{"empty", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := markSnippet(test.headline)
+			if got != test.want {
+				t.Errorf("markSnippet(%q) = %q, want %q", test.headline, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"os"
+	"fmt"
+	"time"
+	"errors"
+	"context"
+	"github.com/jackc/pgx/v5"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+// ListTrash lists deleted documents login may write, latest deleted first
+func (r *Repository) ListTrash(ctx context.Context, login string) (list []*docs.Meta, err error) {
+	const query = "SELECT " + metaColumns + ", deleted_at FROM %s WHERE deleted_at IS NOT NULL AND (owner_login = $1 OR grant_logins @> ANY($2::jsonb[]) OR folder_grants @> ANY($2::jsonb[])) ORDER BY deleted_at DESC, id"
+
+	r.log.Log().Str("login", login).Msg("list trash")
+
+	rows, err := r.pool.Query(ctx, r.table(query), login, grantPatterns(login, docs.PermissionWrite))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	list = make([]*docs.Meta, 0)
+	for rows.Next() {
+		var meta *docs.Meta
+		meta, err = scanTrashed(rows)
+		if err != nil {
+			return
+		}
+
+		list = append(list, meta)
+	}
+
+	err = rows.Err()
+
+	return
+}
+
+// RestoreTrash takes deleted document back from trash,
+// login needs write permission as for deleting it.
+// Expired documents and types denied since then stay in trash
+func (r *Repository) RestoreTrash(ctx context.Context, login, id string) (meta *docs.Meta, err error) {
+	const selectQuery = "SELECT " + metaColumns + ", deleted_at FROM %s WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE"
+	const query = "UPDATE %s SET deleted_at = NULL WHERE id = $1 RETURNING updated_at"
+
+	r.log.Log().Str("login", login).Str("id", id).Msg("restore from trash")
+
+	var tx pgx.Tx
+	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		p := recover()
+		switch {
+		case p != nil:
+			_ = tx.Rollback(ctx)
+			panic(p)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
+			_ = tx.Rollback(ctx)
+		default:
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	meta, err = scanTrashed(tx.QueryRow(ctx, r.table(selectQuery), id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, docs.ErrNoDoc
+		}
+		return nil, err
+	}
+
+	err = restorable(meta, login, r.mimes, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var updated time.Time
+	err = tx.QueryRow(ctx, r.table(query), id).Scan(&updated)
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Deleted = ""
+	meta.Updated = updated.Format(time.DateTime)
+	meta.UpdatedTs = updated.UnixNano()
+
+	return
+}
+
+// restorable tells why login may not take meta back from trash, nil if
+// it may. Documents login can not even read are reported missing
+func restorable(meta *docs.Meta, login string, mimes docs.MimePolicy, now time.Time) error {
+	switch {
+	case !meta.Allowed(login, docs.PermissionRead):
+		return docs.ErrNoDoc
+	case !meta.Allowed(login, docs.PermissionWrite):
+		return docs.ErrForbidden
+	case meta.Expired(now):
+		return docs.ErrExpired
+	case !mimes.Permits(meta.Mime), meta.Detected != "" && !mimes.Permits(meta.Detected):
+		return docs.ErrMimeDenied
+	}
+	return nil
+}
+
+// Purge removes up to limit documents deleted before given time for
+// good, with their versions. Blobs no one refers to are released
+func (r *Repository) Purge(ctx context.Context, before time.Time, limit int) (ids []string, err error) {
+	const query = "SELECT id, blob FROM %s WHERE deleted_at < $1 ORDER BY deleted_at LIMIT $2 FOR UPDATE SKIP LOCKED"
+
+	ids, err = r.erase(ctx, r.table(query), before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) > 0 {
+		r.log.Log().Int("count", len(ids)).Msg("trash purged")
+	}
+
+	return
+}
+
+// erase removes documents query selects as id, blob with their versions,
+// blobs no one refers to are released. Ids of removed documents are returned
+func (r *Repository) erase(ctx context.Context, query string, args ...interface{}) (ids []string, err error) {
+	const deleteQuery = "DELETE FROM %s WHERE id = ANY($1)"
+
+	var released []string
+	defer func() {
+		settleBlobs(ctx, r.log, r.blobs, err, nil, released)
+	}()
+
+	var tx pgx.Tx
+	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		p := recover()
+		switch {
+		case p != nil:
+			_ = tx.Rollback(ctx)
+			panic(p)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
+			_ = tx.Rollback(ctx)
+		default:
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, keys := make([]string, 0), make([]string, 0)
+	for rows.Next() {
+		var id string
+		var key *string
+
+		err = rows.Scan(&id, &key)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		ids = append(ids, id)
+		// json documents have no blob, file ones may share it with others
+		if key != nil {
+			keys = append(keys, *key)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return ids, nil
+	}
+
+	// version rows go away with the document, and so do their references
+	for _, id := range ids {
+		var pruned []string
+		pruned, err = r.prune(ctx, tx, id, new(int))
+		if err != nil {
+			return nil, err
+		}
+		released = append(released, pruned...)
+	}
+
+	unused, err := r.refs.unref(ctx, tx, keys)
+	if err != nil {
+		return nil, err
+	}
+	released = append(released, unused...)
+
+	_, err = tx.Exec(ctx, r.table(deleteQuery), ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// trashRow reads deleted_at selected after meta columns
+type trashRow struct {
+	row      pgx.Row
+	deleted  *time.Time
+}
+
+func (t *trashRow) Scan(dest ...interface{}) error {
+	return t.row.Scan(append(dest, t.deleted)...)
+}
+
+func scanTrashed(row pgx.Row) (meta *docs.Meta, err error) {
+	var deleted time.Time
+
+	meta, err = scanMeta(&trashRow{row: row, deleted: &deleted})
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Deleted = deleted.Format(time.DateTime)
+
+	return
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"time"
+	"testing"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+func TestRestorable(t *testing.T) {
+	now := time.Now()
+	mimes := docs.MimePolicy{Deny: []string{"application/x-msdownload"}}
+
+	doc := func(change func(meta *docs.Meta)) *docs.Meta {
+		meta := &docs.Meta{
+			Owner:  "alice",
+			Mime:   "text/plain",
+			Grant:  []docs.Grant{{Login: "bob", Permission: docs.PermissionRead}, {Login: "carol", Permission: docs.PermissionWrite}},
+		}
+		if change != nil {
+			change(meta)
+		}
+		return meta
+	}
+
+	tests := []struct {
+		name   string
+		meta   *docs.Meta
+		login  string
+		err    error
+	}{
+		{"owner", doc(nil), "alice", nil},
+		{"writer", doc(nil), "carol", nil},
+		{"reader", doc(nil), "bob", docs.ErrForbidden},
+		{"stranger", doc(nil), "dave", docs.ErrNoDoc},
+		{"not expired yet", doc(func(meta *docs.Meta) { meta.SetExpires(now.Add(time.Hour)) }), "alice", nil},
+		{"expired", doc(func(meta *docs.Meta) { meta.SetExpires(now.Add(-time.Second)) }), "alice", docs.ErrExpired},
+		{"expired for stranger", doc(func(meta *docs.Meta) { meta.SetExpires(now.Add(-time.Second)) }), "dave", docs.ErrNoDoc},
+		{"denied type", doc(func(meta *docs.Meta) { meta.Mime = "application/x-msdownload" }), "alice", docs.ErrMimeDenied},
+		{"denied detected type", doc(func(meta *docs.Meta) { meta.Detected = "application/x-msdownload" }), "alice", docs.ErrMimeDenied},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := restorable(test.meta, test.login, mimes, now)
+			if err != test.err {
+				t.Errorf("restorable by %s: %v, want %v", test.login, err, test.err)
+			}
+		})
+	}
+}
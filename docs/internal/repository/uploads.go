@@ -0,0 +1,482 @@
+package repository
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"time"
+	"context"
+	"errors"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/bd878/doc_server/docs/internal/blob"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+type Uploads struct {
+	tableName              string
+	metaTableName          string
+	foldersTableName       string
+	mimes                  docs.MimePolicy
+	blobs                  blob.Store
+	refs                   blobRefs
+	pool                  *pgxpool.Pool
+	log                    zerolog.Logger
+}
+
+// NewUploads creates resumable uploads repository, chunks are kept
+// in blobs, completed uploads become documents in metaTableName
+// with content counted in blobsTableName, put in folders of
+// foldersTableName. Types outside of mimes are rejected
+func NewUploads(log zerolog.Logger, tableName, metaTableName, blobsTableName, foldersTableName string, mimes docs.MimePolicy, blobs blob.Store, pool *pgxpool.Pool) *Uploads {
+	return &Uploads{
+		log:                   log,
+		tableName:             tableName,
+		metaTableName:         metaTableName,
+		foldersTableName:      foldersTableName,
+		mimes:                 mimes,
+		blobs:                 blobs,
+		refs:                  blobRefs{tableName: blobsTableName, blobs: blobs},
+		pool:                  pool,
+	}
+}
+
+const uploadColumns = "id, doc_id, chunks, owner_login, name, mime, public, length, \"offset\", expires_at, created_at, parent_id, tags, metadata, doc_expires_at"
+
+// Create starts upload with no chunks. Empty uploads
+// complete at once, meta is the created document then
+func (r *Uploads) Create(ctx context.Context, upload *docs.Upload) (meta *docs.Meta, err error) {
+	r.log.Log().Str("id", upload.ID).Str("owner", upload.Owner).Int64("length", upload.Length).Msg("create upload")
+
+	if !r.mimes.Permits(upload.Mime) {
+		return nil, docs.ErrMimeDenied
+	}
+
+	err = r.insert(ctx, upload)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.Length == 0 {
+		return r.complete(ctx, upload)
+	}
+
+	return
+}
+
+// insert keeps upload row, folder it goes to must be owner's.
+// Folder is not deleted while upload is pending
+func (r *Uploads) insert(ctx context.Context, upload *docs.Upload) (err error) {
+	const query = "INSERT INTO %s(id, doc_id, owner_login, name, mime, public, length, expires_at, parent_id, tags, metadata, doc_expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING created_at"
+
+	doc := upload.Doc()
+	tags, metadata, err := marshalLabels(doc)
+	if err != nil {
+		return err
+	}
+
+	var tx pgx.Tx
+	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		p := recover()
+		switch {
+		case p != nil:
+			_ = tx.Rollback(ctx)
+			panic(p)
+		case err != nil:
+			if err != docs.ErrNoFolder {
+				fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
+			}
+			_ = tx.Rollback(ctx)
+		default:
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	if upload.ParentID != "" {
+		_, err = lockFolder(ctx, tx, r.foldersTableName, upload.Owner, upload.ParentID)
+		if err != nil {
+			return err
+		}
+	}
+
+	var created time.Time
+	err = tx.QueryRow(ctx, r.table(query), upload.ID, upload.DocID, upload.Owner, upload.Name, upload.Mime, upload.Public, upload.Length, time.Unix(upload.ExpiresTs, 0), nullable(upload.ParentID), tags, metadata, expiry(doc)).Scan(&created)
+	if err != nil {
+		return err
+	}
+
+	upload.Expires = time.Unix(upload.ExpiresTs, 0).Format(time.DateTime)
+	upload.Created = created.Format(time.DateTime)
+
+	return
+}
+
+func (r *Uploads) Get(ctx context.Context, id, owner string) (upload *docs.Upload, err error) {
+	const query = "SELECT " + uploadColumns + " FROM %s WHERE id = $1 AND owner_login = $2 AND expires_at > NOW()"
+
+	upload, err = scanUpload(r.pool.QueryRow(ctx, r.table(query), id, owner))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = docs.ErrNoUpload
+		}
+		return nil, err
+	}
+
+	return
+}
+
+// Write stores chunk at offset, which must be current upload offset.
+// When chunk breaks off, received part is kept so client resumes from there.
+// Chunk is streamed before upload row is touched, so no row lock or
+// connection is held meanwhile. meta is the created document, if upload is complete
+func (r *Uploads) Write(ctx context.Context, id, owner string, offset int64, chunk io.Reader) (upload *docs.Upload, meta *docs.Meta, err error) {
+	const query = "UPDATE %s SET \"offset\" = \"offset\" + $4, chunks = array_append(chunks, $5) WHERE id = $1 AND owner_login = $2 AND \"offset\" = $3 AND expires_at > NOW() RETURNING " + uploadColumns
+
+	// request context is gone with the client, written part is stored anyway
+	ctx = context.WithoutCancel(ctx)
+
+	upload, err = r.Get(ctx, id, owner)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if upload.Offset != offset {
+		return nil, nil, docs.ErrUploadOffset
+	}
+
+	// completion failed after last chunk was written, client retries it
+	if upload.Offset == upload.Length {
+		meta, err = r.complete(ctx, upload)
+		return
+	}
+
+	var stored, released []string
+	defer func() {
+		settleBlobs(ctx, r.log, r.blobs, err, stored, released)
+	}()
+
+	key := fmt.Sprintf("uploads/%s/%s", id, uuid.New().String())
+	src := &chunkReader{r: io.LimitReader(chunk, upload.Length-offset)}
+
+	n, err := r.blobs.Put(ctx, key, src)
+	if err != nil {
+		return nil, nil, err
+	}
+	stored = append(stored, key)
+
+	if src.err != nil {
+		r.log.Warn().Err(src.err).Str("id", id).Int64("written", n).Msg("upload chunk broke off")
+	} else if offset+n == upload.Length {
+		var extra [1]byte
+		if k, _ := io.ReadFull(chunk, extra[:]); k > 0 {
+			return nil, nil, docs.ErrUploadLength
+		}
+	}
+
+	if n == 0 {
+		released = stored
+		return upload, nil, nil
+	}
+
+	// other request may have written at the same offset meanwhile
+	upload, err = scanUpload(r.pool.QueryRow(ctx, r.table(query), id, owner, offset, n, key))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = docs.ErrUploadOffset
+		}
+		return nil, nil, err
+	}
+	// chunk is the upload's now, it stays even if completion fails
+	stored = nil
+
+	if upload.Offset == upload.Length {
+		meta, err = r.complete(ctx, upload)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return
+}
+
+// Delete terminates upload and removes received chunks
+func (r *Uploads) Delete(ctx context.Context, id, owner string) (err error) {
+	const query = "DELETE FROM %s WHERE id = $1 AND owner_login = $2 RETURNING chunks"
+
+	r.log.Log().Str("id", id).Str("owner", owner).Msg("delete upload")
+
+	var released []string
+	defer func() {
+		settleBlobs(ctx, r.log, r.blobs, err, nil, released)
+	}()
+
+	var tx pgx.Tx
+	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		p := recover()
+		switch {
+		case p != nil:
+			_ = tx.Rollback(ctx)
+			panic(p)
+		case err != nil:
+			if err != docs.ErrNoUpload {
+				fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
+			}
+			_ = tx.Rollback(ctx)
+		default:
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	err = tx.QueryRow(ctx, r.table(query), id, owner).Scan(&released)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return docs.ErrNoUpload
+		}
+		return
+	}
+
+	return
+}
+
+// Expire removes uploads not completed in time, returns how many
+func (r *Uploads) Expire(ctx context.Context) (count int, err error) {
+	const query = "DELETE FROM %s WHERE expires_at < NOW() RETURNING chunks"
+
+	var released []string
+	defer func() {
+		settleBlobs(ctx, r.log, r.blobs, err, nil, released)
+	}()
+
+	var tx pgx.Tx
+	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		p := recover()
+		switch {
+		case p != nil:
+			_ = tx.Rollback(ctx)
+			panic(p)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
+			_ = tx.Rollback(ctx)
+		default:
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	rows, err := tx.Query(ctx, r.table(query))
+	if err != nil {
+		return
+	}
+
+	chunks, err := pgx.CollectRows(rows, pgx.RowTo[[]string])
+	if err != nil {
+		return
+	}
+
+	for _, keys := range chunks {
+		released = append(released, keys...)
+	}
+
+	return len(chunks), nil
+}
+
+// complete turns finished upload into file document. Chunks are joined
+// into a new blob before any row is locked, then upload row is claimed
+// and document inserted in a short transaction. Uploads of denied
+// types are dropped, their content never becomes a document
+func (r *Uploads) complete(ctx context.Context, upload *docs.Upload) (meta *docs.Meta, err error) {
+	const claimQuery = "DELETE FROM %s WHERE id = $1 AND \"offset\" = length RETURNING chunks"
+	const insertQuery = "INSERT INTO %s(id, blob, sha256, name, file, public, mime, detected_mime, owner_login, size, content_text, parent_id, folder_grants, tags, metadata, expires_at) VALUES ($1, $2, $3, $4, true, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING " + metaColumns
+
+	r.log.Log().Str("id", upload.ID).Str("doc_id", upload.DocID).Msg("complete upload")
+
+	joined, digest, detected, text, err := r.join(ctx, upload)
+	if err == docs.ErrMimeDenied {
+		if err := r.Delete(ctx, upload.ID, upload.Owner); err != nil && err != docs.ErrNoUpload {
+			r.log.Error().Err(err).Str("id", upload.ID).Msg("failed to drop denied upload")
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored, released []string
+	stored = append(stored, joined)
+	defer func() {
+		settleBlobs(ctx, r.log, r.blobs, err, stored, released)
+	}()
+
+	var tx pgx.Tx
+	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		p := recover()
+		switch {
+		case p != nil:
+			_ = tx.Rollback(ctx)
+			panic(p)
+		case err != nil:
+			if err != docs.ErrNoUpload {
+				fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
+			}
+			_ = tx.Rollback(ctx)
+		default:
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	// concurrent request completed or terminated it already
+	var chunks []string
+	err = tx.QueryRow(ctx, r.table(claimQuery), upload.ID).Scan(&chunks)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, docs.ErrNoUpload
+		}
+		return nil, err
+	}
+
+	shared, err := r.refs.ref(ctx, tx, joined, digest, upload.Length)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := upload.Doc()
+	doc.Inherited, err = inheritedGrants(ctx, tx, r.foldersTableName, upload.Owner, upload.ParentID)
+	if err != nil {
+		return nil, err
+	}
+
+	inherited, err := marshalGrant(doc.Inherited)
+	if err != nil {
+		return nil, err
+	}
+	tags, metadata, err := marshalLabels(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err = scanMeta(tx.QueryRow(ctx, fmt.Sprintf(insertQuery, r.metaTableName), upload.DocID, shared, digest, upload.Name, upload.Public, upload.Mime, detected, upload.Owner, upload.Length, text.value(), nullable(upload.ParentID), inherited, tags, metadata, expiry(doc)))
+	if err != nil {
+		return nil, err
+	}
+
+	released = chunks
+	if shared != joined {
+		released = append(released, joined)
+	}
+
+	return
+}
+
+// join streams chunks of upload into a new blob, sniffing its type
+// and hashing it on the way. No transaction is open meanwhile
+func (r *Uploads) join(ctx context.Context, upload *docs.Upload) (key, digest, detected string, text *searchText, err error) {
+	pr, pw := io.Pipe()
+	go func() {
+		for _, chunk := range upload.Chunks {
+			if err := r.blobs.Get(ctx, chunk, pw); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	detected, content, err := sniffMime(pr, upload.Name)
+	if err == nil && !r.mimes.Permits(detected) {
+		r.log.Warn().Str("id", upload.ID).Str("declared", upload.Mime).Str("detected", detected).Msg("mime type denied")
+		err = docs.ErrMimeDenied
+	}
+	if err != nil {
+		pr.CloseWithError(err)
+		return "", "", "", nil, err
+	}
+
+	content, text = captureText(detected, content)
+
+	key, digest, size, err := r.refs.put(ctx, content)
+	pr.CloseWithError(err)
+	if err != nil {
+		return "", "", "", nil, err
+	}
+
+	if size != upload.Length {
+		settleBlobs(ctx, r.log, r.blobs, nil, nil, []string{key})
+		return "", "", "", nil, fmt.Errorf("upload %s joined to %d bytes of %d", upload.ID, size, upload.Length)
+	}
+
+	return
+}
+
+func (r Uploads) table(query string) string {
+	return fmt.Sprintf(query, r.tableName)
+}
+
+// chunkReader ends chunk where client connection broke, so the
+// part received is stored, err is what broke it
+type chunkReader struct {
+	r   io.Reader
+	err error
+}
+
+func (c *chunkReader) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	if err != nil && err != io.EOF {
+		c.err = err
+		err = io.EOF
+	}
+	return
+}
+
+func scanUpload(row pgx.Row) (upload *docs.Upload, err error) {
+	var expires, created time.Time
+	var docExpires *time.Time
+	var parent *string
+	var tags, metadata []byte
+
+	upload = &docs.Upload{}
+
+	err = row.Scan(&upload.ID, &upload.DocID, &upload.Chunks, &upload.Owner, &upload.Name, &upload.Mime, &upload.Public, &upload.Length, &upload.Offset, &expires, &created, &parent, &tags, &metadata, &docExpires)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(tags, &upload.Tags)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(metadata, &upload.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	if parent != nil {
+		upload.ParentID = *parent
+	}
+	if docExpires != nil {
+		upload.DocExpiresTs = docExpires.Unix()
+	}
+
+	upload.Expires = expires.Format(time.DateTime)
+	upload.ExpiresTs = expires.Unix()
+	upload.Created = created.Format(time.DateTime)
+
+	return
+}
@@ -0,0 +1,242 @@
+package repository
+
+import (
+	"os"
+	"fmt"
+	"time"
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	docs "github.com/bd878/doc_server/docs/pkg/model"
+)
+
+const versionColumns = "version, blob, sha256, name, file, mime, detected_mime, size, created_at, archived_at"
+
+func (r *Repository) ListVersions(ctx context.Context, id string) (list []*docs.Version, err error) {
+	const query = "SELECT " + versionColumns + " FROM %s WHERE doc_id = $1 ORDER BY version DESC"
+
+	r.log.Log().Str("id", id).Msg("list versions")
+
+	rows, err := r.pool.Query(ctx, r.versions(query), id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	list = make([]*docs.Version, 0)
+	for rows.Next() {
+		var version *docs.Version
+		version, err = scanVersion(rows)
+		if err != nil {
+			return
+		}
+
+		list = append(list, version)
+	}
+
+	err = rows.Err()
+
+	return
+}
+
+// GetVersion returns previous version of a document,
+// json is set for json documents
+func (r *Repository) GetVersion(ctx context.Context, id string, n int) (version *docs.Version, jsonData []byte, err error) {
+	const query = "SELECT " + versionColumns + " FROM %s WHERE doc_id = $1 AND version = $2"
+	const jsonQuery = "SELECT json FROM %s WHERE doc_id = $1 AND version = $2"
+
+	r.log.Log().Str("id", id).Int("version", n).Msg("get version")
+
+	version, err = scanVersion(r.pool.QueryRow(ctx, r.versions(query), id, n))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = docs.ErrNoVersion
+		}
+		return nil, nil, err
+	}
+
+	if !version.File {
+		err = r.pool.QueryRow(ctx, r.versions(jsonQuery), id, n).Scan(&jsonData)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return
+}
+
+// Restore makes version n content current again, file content is
+// shared with the version. Replaced content is kept as a version as well
+func (r *Repository) Restore(ctx context.Context, id string, n int) (meta *docs.Meta, err error) {
+	const lockQuery = "SELECT max_versions, owner_login, COALESCE(schema_name, '') FROM %s WHERE id = $1 FOR UPDATE"
+	const versionQuery = "SELECT blob, sha256, name, file, json, mime, detected_mime, size, content_text FROM %s WHERE doc_id = $1 AND version = $2"
+	const query = "UPDATE %s SET blob = $2, sha256 = $3, name = $4, file = $5, json = $6, mime = $7, detected_mime = $8, size = $9, content_text = $10, schema_name = CASE WHEN $5 THEN NULL ELSE schema_name END, version = version + 1, revision = revision + 1, updated_at = NOW() WHERE id = $1"
+	const metaQuery = "SELECT " + metaColumns + " FROM %s WHERE id = $1"
+
+	r.log.Log().Str("id", id).Int("version", n).Msg("restore version")
+
+	var released []string
+	defer func() {
+		settleBlobs(ctx, r.log, r.blobs, err, nil, released)
+	}()
+
+	var tx pgx.Tx
+	tx, err = r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		p := recover()
+		switch {
+		case p != nil:
+			_ = tx.Rollback(ctx)
+			panic(p)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
+			_ = tx.Rollback(ctx)
+		default:
+			err = tx.Commit(ctx)
+		}
+	}()
+
+	var maxVersions *int
+	var owner, schema string
+	err = tx.QueryRow(ctx, r.table(lockQuery), id).Scan(&maxVersions, &owner, &schema)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, docs.ErrNoDoc
+		}
+		return nil, err
+	}
+
+	var key, sum, detected, text *string
+	var name, mime string
+	var file bool
+	var jsonData []byte
+	var size int64
+
+	err = tx.QueryRow(ctx, r.versions(versionQuery), id, n).Scan(&key, &sum, &name, &file, &jsonData, &mime, &detected, &size, &text)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, docs.ErrNoVersion
+		}
+		return nil, err
+	}
+
+	// mime policy may have changed since the version was saved, as may schema
+	if !r.mimes.Permits(mime) || (detected != nil && !r.mimes.Permits(*detected)) {
+		return nil, docs.ErrMimeDenied
+	}
+
+	if !file {
+		err = r.validate(ctx, tx, owner, schema, jsonData)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = r.archive(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// version keeps its blob, current content is one more reference
+	if key != nil {
+		err = r.refs.addRef(ctx, tx, *key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(ctx, r.table(query), id, key, sum, name, file, jsonData, mime, detected, size, text)
+	if err != nil {
+		return nil, err
+	}
+
+	released, err = r.prune(ctx, tx, id, maxVersions)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMeta(tx.QueryRow(ctx, r.table(metaQuery), id))
+}
+
+// archive saves current content of a document as a version
+func (r *Repository) archive(ctx context.Context, tx pgx.Tx, id string) (err error) {
+	const query = "INSERT INTO %s(doc_id, version, blob, sha256, name, file, json, mime, detected_mime, size, content_text, created_at) SELECT id, version, blob, sha256, name, file, json, mime, detected_mime, size, content_text, updated_at FROM %s WHERE id = $1"
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(query, r.versionsTableName, r.tableName), id)
+
+	return
+}
+
+// prune drops versions above retention limit, nil limit means
+// server default. Blobs referenced by dropped versions only are
+// returned to be removed once transaction commits
+func (r *Repository) prune(ctx context.Context, tx pgx.Tx, id string, maxVersions *int) (released []string, err error) {
+	const query = "DELETE FROM %s WHERE doc_id = $1 AND version IN (SELECT version FROM %s WHERE doc_id = $1 ORDER BY version DESC OFFSET $2) RETURNING blob"
+
+	limit := r.maxVersions
+	if maxVersions != nil {
+		limit = *maxVersions
+	}
+	if limit < 0 {
+		limit = 0
+	}
+
+	rows, err := tx.Query(ctx, fmt.Sprintf(query, r.versionsTableName, r.versionsTableName), id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]string, 0)
+	for rows.Next() {
+		var key *string
+		err = rows.Scan(&key)
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			keys = append(keys, *key)
+		}
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return r.refs.unref(ctx, tx, keys)
+}
+
+func (r Repository) versions(query string) string {
+	return fmt.Sprintf(query, r.versionsTableName)
+}
+
+func scanVersion(row pgx.Row) (version *docs.Version, err error) {
+	var created, archived time.Time
+	var key, sum, detected *string
+
+	version = &docs.Version{}
+
+	err = row.Scan(&version.Version, &key, &sum, &version.Name, &version.File, &version.Mime, &detected, &version.Size, &created, &archived)
+	if err != nil {
+		return nil, err
+	}
+
+	if key != nil {
+		version.Blob = *key
+	}
+	if sum != nil {
+		version.SHA256 = *sum
+	}
+	if detected != nil {
+		version.Detected = *detected
+	}
+
+	version.Created = created.Format(time.DateTime)
+	version.Archived = archived.Format(time.DateTime)
+
+	return
+}
@@ -1,15 +1,22 @@
 package docs
 
 import (
+	"time"
 	"context"
+	"crypto/rand"
+	"github.com/rs/zerolog"
+	"github.com/bd878/doc_server/internal/waiter"
 	"github.com/bd878/doc_server/internal/system"
 	"github.com/bd878/doc_server/internal/grpc"
+	"github.com/bd878/doc_server/internal/ratelimit"
 	"github.com/bd878/doc_server/docs/internal/controller"
 	docsGrpc "github.com/bd878/doc_server/docs/internal/grpc"
 	"github.com/bd878/doc_server/docs/internal/handlers"
 	"github.com/bd878/doc_server/docs/internal/cache"
+	"github.com/bd878/doc_server/docs/internal/blob"
 	"github.com/bd878/doc_server/docs/internal/repository"
 	"github.com/bd878/doc_server/docs/internal/gateway/users"
+	"github.com/bd878/doc_server/docs/pkg/model"
 )
 
 type Module struct {
@@ -24,11 +31,121 @@ func (Module) Startup(ctx context.Context, mono system.Service) (err error) {
 	gateway := users.NewGateway(conn)
 	cache := cache.New(mono.Logger())
 
-	docs := repository.New(mono.Logger(), "docs.meta", mono.DB())
-	ctrl := controller.New(docs, cache)
+	log := mono.Logger()
 
-	handlers.RegisterHandlers(mono.Mux(), ctrl, gateway, mono.Logger())
+	secret := []byte(mono.Config().Docs.LinkSecret)
+	if len(secret) == 0 {
+		log.Warn().Msg("no link secret configured, share links will not survive restart")
+		secret = make([]byte, 32)
+		if _, err = rand.Read(secret); err != nil {
+			return err
+		}
+	}
+
+	blobs, err := blob.New(mono.Config().Docs.Blob, mono.DB())
+	if err != nil {
+		return err
+	}
+
+	// files kept before another store was configured are in large objects
+	if mono.Config().Docs.Blob.Store != "postgres" {
+		moved, err := blob.Move(ctx, blob.NewLargeObjects("docs.large_objects", mono.DB()), blobs)
+		if err != nil {
+			return err
+		}
+		if moved > 0 {
+			log.Info().Int("count", moved).Msg("large objects moved to blob store")
+		}
+	}
+
+	mimes := model.MimePolicy{Allow: mono.Config().Docs.MimeAllow, Deny: mono.Config().Docs.MimeDeny}
+
+	docs := repository.New(mono.Logger(), "docs.meta", "docs.versions", "docs.blobs", "docs.schemas", "docs.folders", mono.Config().Docs.MaxVersions, mono.Config().Docs.MaxJSONSize, mimes, blobs, mono.DB())
+	links := repository.NewLinks(mono.Logger(), "docs.links", mono.DB())
+	uploads := repository.NewUploads(mono.Logger(), "docs.uploads", "docs.meta", "docs.blobs", "docs.folders", mimes, blobs, mono.DB())
+	ctrl := controller.New(docs, links, uploads, cache, secret, mono.Config().Docs.LinkTTL, mono.Config().Docs.UploadTTL, mono.Config().Docs.TrashTTL)
+
+	limiter := ratelimit.New(mono.Config().Docs.PublicRateLimit, time.Minute)
+
+	handlers.RegisterHandlers(mono.Mux(), ctrl, gateway, limiter, mono.Config().Docs.MaxFileSize, mono.Config().Docs.MaxJSONSize, mono.Config().Docs.UploadMaxSize, mono.Logger())
 	docsGrpc.RegisterServer(ctrl, mono.RPC())
 
+	mono.Waiter().Add(expireUploads(ctrl, log))
+	mono.Waiter().Add(purgeTrash(ctrl, log))
+	mono.Waiter().Add(reapExpired(ctrl, log))
+
 	return nil
 }
+
+// expireUploads periodically removes unfinished uploads past their lifetime
+func expireUploads(ctrl *controller.Controller, log zerolog.Logger) waiter.WaitFunc {
+	return func(ctx context.Context) error {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				count, err := ctrl.ExpireUploads(ctx)
+				if err != nil {
+					log.Error().Err(err).Msg("failed to expire uploads")
+					continue
+				}
+				if count > 0 {
+					log.Info().Int("count", count).Msg("expired uploads removed")
+				}
+			}
+		}
+	}
+}
+
+// purgeTrash periodically removes documents kept in trash for too long
+func purgeTrash(ctrl *controller.Controller, log zerolog.Logger) waiter.WaitFunc {
+	return func(ctx context.Context) error {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				count, err := ctrl.PurgeTrash(ctx)
+				if err != nil {
+					log.Error().Err(err).Msg("failed to purge trash")
+					continue
+				}
+				if count > 0 {
+					log.Info().Int("count", count).Msg("trashed documents purged")
+				}
+			}
+		}
+	}
+}
+
+// reapExpired periodically removes expired documents, until then
+// readers are told they are gone
+func reapExpired(ctrl *controller.Controller, log zerolog.Logger) waiter.WaitFunc {
+	return func(ctx context.Context) error {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				count, err := ctrl.ReapExpired(ctx)
+				if err != nil {
+					log.Error().Err(err).Msg("failed to reap expired docs")
+					continue
+				}
+				if count > 0 {
+					log.Info().Int("count", count).Msg("expired docs removed")
+				}
+			}
+		}
+	}
+}
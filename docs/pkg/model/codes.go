@@ -9,4 +9,42 @@ var (
 	CodeBadLimit     int = 206
 	CodeDocNotFound  int = 207
 	CodeNoJSON       int = 208
+	CodeNoGrantee    int = 209
+	CodeBadGrant     int = 210
+	CodeNoGrant      int = 211
+	CodeForbidden    int = 212
+	CodeNoOwner      int = 213
+	CodeNoLink       int = 214
+	CodeBadLink      int = 215
+	CodeLinkExpired  int = 216
+	CodeLinkPassword int = 217
+	CodeBadExpiry    int = 218
+	CodeBadDownloads int = 219
+	CodeNoVersion    int = 220
+	CodeBadVersion   int = 221
+	CodePrecondition int = 222
+	CodeBadRange     int = 223
+	CodeNoUpload     int = 224
+	CodeUploadOffset int = 225
+	CodeUploadLength int = 226
+	CodeBadUpload    int = 227
+	CodeFileTooLarge int = 228
+	CodeChecksum     int = 229
+	CodeMimeDenied   int = 230
+	CodeBadQuery     int = 231
+	CodeBadCursor    int = 232
+	CodeNoPath       int = 233
+	CodeNotJSON      int = 234
+	CodeBadPatch     int = 235
+	CodePatchConflict int = 236
+	CodeNoSchema     int = 237
+	CodeBadSchema    int = 238
+	CodeSchemaInUse  int = 239
+	CodeSchemaViolation int = 240
+	CodeNoFolder     int = 241
+	CodeBadFolder    int = 242
+	CodeFolderExists int = 243
+	CodeFolderNotEmpty int = 244
+	CodeBadMetadata  int = 245
+	CodeExpired      int = 246
 )
\ No newline at end of file
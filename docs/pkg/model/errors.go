@@ -3,5 +3,37 @@ package model
 import "errors"
 
 var (
-	ErrNoDoc    = errors.New("no document")
+	ErrNoDoc          = errors.New("no document")
+	ErrNoGrant        = errors.New("no grant")
+	ErrBadPermission  = errors.New("bad permission")
+	ErrForbidden      = errors.New("forbidden")
+	ErrNoLink         = errors.New("no link")
+	ErrBadLink        = errors.New("bad link signature")
+	ErrLinkExpired    = errors.New("link expired")
+	ErrLinkPassword   = errors.New("wrong link password")
+	ErrNoVersion      = errors.New("no version")
+	ErrPrecondition   = errors.New("precondition failed")
+	ErrBadRange       = errors.New("range not satisfiable")
+	ErrNoUpload       = errors.New("no upload")
+	ErrUploadOffset   = errors.New("upload offset mismatch")
+	ErrUploadLength   = errors.New("upload length exceeded")
+	ErrFileTooLarge   = errors.New("file too large")
+	ErrChecksum       = errors.New("checksum mismatch")
+	ErrMimeDenied     = errors.New("mime type not allowed")
+	ErrBadQuery       = errors.New("bad query")
+	ErrBadCursor      = errors.New("bad cursor")
+	ErrNoPath         = errors.New("nothing at json path")
+	ErrNotJSON        = errors.New("not a json document")
+	ErrBadPatch       = errors.New("bad patch")
+	ErrPatchConflict  = errors.New("patch does not apply")
+	ErrNoSchema       = errors.New("no schema")
+	ErrBadSchema      = errors.New("bad schema")
+	ErrSchemaInUse    = errors.New("schema in use")
+	ErrSchemaViolation = errors.New("json does not match schema")
+	ErrNoFolder       = errors.New("no folder")
+	ErrBadFolder      = errors.New("bad folder")
+	ErrFolderExists   = errors.New("folder exists")
+	ErrFolderNotEmpty = errors.New("folder not empty")
+	ErrBadMetadata    = errors.New("bad tags or metadata")
+	ErrExpired        = errors.New("document expired")
 )
\ No newline at end of file
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ETag is a strong entity tag of current document revision,
+// file documents tag carries content digest as well
+func (m *Meta) ETag() string {
+	if m.SHA256 != "" {
+		return fmt.Sprintf("\"%s-%d\"", m.SHA256, m.Revision)
+	}
+	return fmt.Sprintf("\"%s-%d\"", m.ID, m.Revision)
+}
+
+// MatchETag checks If-Match / If-None-Match header value against etag.
+// Weak comparison ignores W/ prefix, strong never matches weak tags
+func MatchETag(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+
+		if tag == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
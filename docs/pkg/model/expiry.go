@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// Expired tells if document is past its expiry at now
+func (m *Meta) Expired(now time.Time) bool {
+	return m.ExpiresTs != 0 && m.ExpiresTs <= now.Unix()
+}
+
+// SetExpires sets when document expires, zero time keeps it forever
+func (m *Meta) SetExpires(t time.Time) {
+	if t.IsZero() {
+		m.Expires, m.ExpiresTs = "", 0
+		return
+	}
+	m.Expires = t.Format(time.DateTime)
+	m.ExpiresTs = t.Unix()
+}
+
+// ExpiresAt is expiry of document, zero time if it never expires
+func (m *Meta) ExpiresAt() time.Time {
+	if m.ExpiresTs == 0 {
+		return time.Time{}
+	}
+	return time.Unix(m.ExpiresTs, 0)
+}
+
+// ParseExpiry reads RFC 3339 expiry, empty value is no expiry
+func ParseExpiry(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,59 @@
+package model
+
+import "strings"
+
+// Folder organizes documents of its owner. Path is folder names from
+// root joined with /. Grants of a folder are inherited by everything
+// inside of it, Inherited are those of folders above
+type Folder struct {
+	ID         string    `json:"id"`
+	Owner      string    `json:"owner"`
+	ParentID   string    `json:"parent_id,omitempty"`
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Grant      []Grant   `json:"grant"`
+	Inherited  []Grant   `json:"inherited_grant,omitempty"`
+	Created    string    `json:"created"`
+	Updated    string    `json:"updated"`
+}
+
+type FoldersResponse struct {
+	Folders  []*Folder   `json:"folders"`
+}
+
+// ValidFolderName tells if name may be a path element
+func ValidFolderName(name string) bool {
+	return name != "" && name != "." && name != ".." && len(name) <= 256 && !strings.Contains(name, "/")
+}
+
+// FolderPath is path of folder name inside of parent path,
+// which is empty for folders at root
+func FolderPath(parent, name string) string {
+	return parent + "/" + name
+}
+
+// Effective are grants everything inside of folder is given
+func (f *Folder) Effective() []Grant {
+	return MergeGrants(f.Inherited, f.Grant)
+}
+
+func (f *Folder) Permission(login string) Permission {
+	if login != "" && f.Owner == login {
+		return PermissionShare
+	}
+	return grantPermission(login, f.Grant, f.Inherited)
+}
+
+func (f *Folder) Allowed(login string, perm Permission) bool {
+	return f.Permission(login).Allows(perm)
+}
+
+// SetGrant adds grant or replaces permission of existing grantee
+func (f *Folder) SetGrant(grant Grant) {
+	f.Grant = setGrant(f.Grant, grant)
+}
+
+func (f *Folder) RevokeGrant(login string) (found bool) {
+	f.Grant, found = revokeGrant(f.Grant, login)
+	return
+}
@@ -0,0 +1,173 @@
+package model
+
+import (
+	"encoding/json"
+)
+
+type Permission string
+
+const (
+	PermissionRead   Permission = "read"
+	PermissionWrite  Permission = "write"
+	PermissionShare  Permission = "share"
+)
+
+type Grant struct {
+	Login       string         `json:"login"`
+	Permission  Permission     `json:"permission"`
+}
+
+// level orders permissions, each one includes all below
+func (p Permission) level() int {
+	switch p {
+	case PermissionRead:
+		return 1
+	case PermissionWrite:
+		return 2
+	case PermissionShare:
+		return 3
+	default:
+		return 0
+	}
+}
+
+func (p Permission) Valid() bool {
+	return p.level() > 0
+}
+
+// Allows reports if p is enough for an action requiring perm
+func (p Permission) Allows(perm Permission) bool {
+	return p.Valid() && p.level() >= perm.level()
+}
+
+// Permissions lists p and every permission above it
+func (p Permission) Permissions() (list []Permission) {
+	for _, perm := range []Permission{PermissionRead, PermissionWrite, PermissionShare} {
+		if perm.Allows(p) {
+			list = append(list, perm)
+		}
+	}
+	return
+}
+
+// UnmarshalJSON accepts a bare login as a read grant,
+// that is how grants were stored before permissions
+func (g *Grant) UnmarshalJSON(data []byte) error {
+	var login string
+	if err := json.Unmarshal(data, &login); err == nil {
+		g.Login = login
+		g.Permission = PermissionRead
+		return nil
+	}
+
+	type grant Grant
+	var raw grant
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	if raw.Permission == "" {
+		raw.Permission = PermissionRead
+	}
+	if !raw.Permission.Valid() {
+		return ErrBadPermission
+	}
+
+	*g = Grant(raw)
+	return nil
+}
+
+// Permission returns what login may do with the document,
+// owner is allowed everything, anyone may read public one.
+// Grants of folders document is in count as its own
+func (m *Meta) Permission(login string) Permission {
+	if login != "" && m.Owner == login {
+		return PermissionShare
+	}
+	if perm := grantPermission(login, m.Grant, m.Inherited); perm != "" {
+		return perm
+	}
+	if m.Public {
+		return PermissionRead
+	}
+	return ""
+}
+
+// grantPermission is the highest permission login is granted
+func grantPermission(login string, grants ...[]Grant) (perm Permission) {
+	if login == "" {
+		return ""
+	}
+	for _, list := range grants {
+		for _, grant := range list {
+			if grant.Login == login && grant.Permission.level() > perm.level() {
+				perm = grant.Permission
+			}
+		}
+	}
+	return
+}
+
+// MergeGrants joins grant lists, login keeps the highest permission
+func MergeGrants(lists ...[]Grant) []Grant {
+	merged := make([]Grant, 0)
+	for _, list := range lists {
+		for _, grant := range list {
+			if grant.Permission.level() > grantPermission(grant.Login, merged).level() {
+				merged = setGrant(merged, grant)
+			}
+		}
+	}
+	return merged
+}
+
+func (m *Meta) Allowed(login string, perm Permission) bool {
+	return m.Permission(login).Allows(perm)
+}
+
+// SetGrant adds grant or replaces permission of existing grantee
+func (m *Meta) SetGrant(grant Grant) {
+	m.Grant = setGrant(m.Grant, grant)
+}
+
+func (m *Meta) RevokeGrant(login string) (found bool) {
+	m.Grant, found = revokeGrant(m.Grant, login)
+	return
+}
+
+func setGrant(grants []Grant, grant Grant) []Grant {
+	for i := range grants {
+		if grants[i].Login == grant.Login {
+			grants[i].Permission = grant.Permission
+			return grants
+		}
+	}
+	return append(grants, grant)
+}
+
+func revokeGrant(grants []Grant, login string) ([]Grant, bool) {
+	for i := range grants {
+		if grants[i].Login == login {
+			return append(grants[:i], grants[i+1:]...), true
+		}
+	}
+	return grants, false
+}
+
+func SameGrants(a, b []Grant) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	perms := make(map[string]Permission, len(a))
+	for _, grant := range a {
+		perms[grant.Login] = grant.Permission
+	}
+	for _, grant := range b {
+		perm, ok := perms[grant.Login]
+		if !ok || perm != grant.Permission {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,205 @@
+package model
+
+import (
+	"time"
+	"strings"
+	"encoding/json"
+	"encoding/base64"
+)
+
+// Sort fields documents may be listed by
+const (
+	SortCreated = "created"
+	SortUpdated = "updated"
+	SortName    = "name"
+	SortSize    = "size"
+)
+
+// ListQuery selects documents of Owner, or documents granted to Login
+// if set. Filters are combined with AND, nil ones do not filter.
+// Created range includes CreatedAfter and excludes CreatedBefore
+type ListQuery struct {
+	Owner          string
+	Login          string
+	Name           *string
+	NamePrefix     *string
+	Mime           *string
+	File           *bool
+	Public         *bool
+	CreatedAfter   *time.Time
+	CreatedBefore  *time.Time
+	MinSize        *int64
+	MaxSize        *int64
+	JSONContains   json.RawMessage
+	JSONPath       *string
+	ParentID       *string // folder, empty for root
+	Tags           []string // documents tagged with all of them
+	Metadata       map[string]string // documents having all of key values
+	Sort           string
+	Desc           bool
+	Limit          int
+	Cursor         *Cursor
+}
+
+// ListSummary describes all documents a list query matches,
+// Modified is the latest update, zero if there are none
+type ListSummary struct {
+	Count     int64
+	Size      int64
+	Modified  time.Time
+}
+
+// Cursor points at the last document of a page, next page starts
+// right after it. It is valid for the sort order it was made for only
+type Cursor struct {
+	Sort   string  `json:"s"`
+	Desc   bool    `json:"d"`
+	ID     string  `json:"id"`
+	Name   string  `json:"n,omitempty"`
+	Value  int64   `json:"v,omitempty"` // time in ns or size
+}
+
+func ValidSort(sort string) bool {
+	switch sort {
+	case SortCreated, SortUpdated, SortName, SortSize:
+		return true
+	}
+	return false
+}
+
+// Cacheable tells if Match is able to check all filters,
+// json ones need content which is not cached
+func (q *ListQuery) Cacheable() bool {
+	return q.JSONContains == nil && q.JSONPath == nil
+}
+
+// Selects tells if meta is one of documents query lists: owned by
+// Owner, or granted to Login for reading if set, as repository selects
+func (q *ListQuery) Selects(meta *Meta) bool {
+	if q.Login != "" {
+		return grantPermission(q.Login, meta.Grant, meta.Inherited).Allows(PermissionRead)
+	}
+	return meta.Owner == q.Owner
+}
+
+// Match tells if meta is selected and passes query filters, cursor aside
+func (q *ListQuery) Match(meta *Meta) bool {
+	switch {
+	case !q.Selects(meta):
+		return false
+	case q.ParentID != nil && meta.ParentID != *q.ParentID:
+		return false
+	case q.Name != nil && meta.Name != *q.Name:
+		return false
+	case q.NamePrefix != nil && !strings.HasPrefix(meta.Name, *q.NamePrefix):
+		return false
+	case q.Mime != nil && meta.Mime != *q.Mime:
+		return false
+	case q.File != nil && meta.File != *q.File:
+		return false
+	case q.Public != nil && meta.Public != *q.Public:
+		return false
+	case q.CreatedAfter != nil && meta.Ts < q.CreatedAfter.UnixNano():
+		return false
+	case q.CreatedBefore != nil && meta.Ts >= q.CreatedBefore.UnixNano():
+		return false
+	case q.MinSize != nil && meta.Size < *q.MinSize:
+		return false
+	case q.MaxSize != nil && meta.Size > *q.MaxSize:
+		return false
+	case !meta.HasTags(q.Tags):
+		return false
+	case !meta.HasMetadata(q.Metadata):
+		return false
+	case meta.Expired(time.Now()):
+		return false
+	}
+	return true
+}
+
+// Less orders documents by query sort, ties are broken by id
+func (q *ListQuery) Less(a, b *Meta) bool {
+	c := compareSort(q.Sort, a, b)
+	if c == 0 {
+		c = strings.Compare(a.ID, b.ID)
+	}
+	if q.Desc {
+		return c > 0
+	}
+	return c < 0
+}
+
+// After tells if meta comes after query cursor
+func (q *ListQuery) After(meta *Meta) bool {
+	if q.Cursor == nil {
+		return true
+	}
+
+	last := q.Cursor.meta()
+	return q.Less(last, meta)
+}
+
+// NextCursor encodes position after meta, the last document listed
+func (q *ListQuery) NextCursor(meta *Meta) string {
+	cursor := Cursor{Sort: q.Sort, Desc: q.Desc, ID: meta.ID}
+	switch q.Sort {
+	case SortCreated:
+		cursor.Value = meta.Ts
+	case SortUpdated:
+		cursor.Value = meta.UpdatedTs
+	case SortName:
+		cursor.Name = meta.Name
+	case SortSize:
+		cursor.Value = meta.Size
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes cursor made for sort order given
+func ParseCursor(value, sort string, desc bool) (cursor *Cursor, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrBadCursor
+	}
+
+	cursor = &Cursor{}
+	if err = json.Unmarshal(data, cursor); err != nil {
+		return nil, ErrBadCursor
+	}
+
+	if cursor.Sort != sort || cursor.Desc != desc || cursor.ID == "" {
+		return nil, ErrBadCursor
+	}
+
+	return cursor, nil
+}
+
+// meta is a stand-in for the document cursor points at
+func (c *Cursor) meta() *Meta {
+	return &Meta{ID: c.ID, Name: c.Name, Ts: c.Value, UpdatedTs: c.Value, Size: c.Value}
+}
+
+func compareSort(sort string, a, b *Meta) int {
+	switch sort {
+	case SortUpdated:
+		return compareInt(a.UpdatedTs, b.UpdatedTs)
+	case SortName:
+		return strings.Compare(a.Name, b.Name)
+	case SortSize:
+		return compareInt(a.Size, b.Size)
+	default:
+		return compareInt(a.Ts, b.Ts)
+	}
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
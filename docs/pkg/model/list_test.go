@@ -0,0 +1,226 @@
+package model
+
+import (
+	"sort"
+	"time"
+	"testing"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestCursor(t *testing.T) {
+	meta := &Meta{ID: "b", Name: "report", Ts: 100, UpdatedTs: 200, Size: 300}
+
+	tests := []struct {
+		sort  string
+		desc  bool
+		want  Cursor
+	}{
+		{SortCreated, false, Cursor{Sort: SortCreated, ID: "b", Value: 100}},
+		{SortUpdated, true, Cursor{Sort: SortUpdated, Desc: true, ID: "b", Value: 200}},
+		{SortName, false, Cursor{Sort: SortName, ID: "b", Name: "report"}},
+		{SortSize, true, Cursor{Sort: SortSize, Desc: true, ID: "b", Value: 300}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.sort, func(t *testing.T) {
+			q := &ListQuery{Sort: test.sort, Desc: test.desc}
+
+			cursor, err := ParseCursor(q.NextCursor(meta), test.sort, test.desc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *cursor != test.want {
+				t.Errorf("cursor %+v, want %+v", *cursor, test.want)
+			}
+
+			_, err = ParseCursor(q.NextCursor(meta), test.sort, !test.desc)
+			if err != ErrBadCursor {
+				t.Errorf("cursor of other order: %v, want ErrBadCursor", err)
+			}
+		})
+	}
+}
+
+func TestParseCursorBad(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+	}{
+		{"not base64", "!!!"},
+		{"not json", "bm90IGpzb24"},
+		{"no id", "eyJzIjoiY3JlYXRlZCJ9"}, // {"s":"created"}
+		{"other sort", "eyJzIjoibmFtZSIsImlkIjoiYSJ9"}, // {"s":"name","id":"a"}
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseCursor(test.value, SortCreated, false)
+			if err != ErrBadCursor {
+				t.Errorf("got %v, want ErrBadCursor", err)
+			}
+		})
+	}
+}
+
+func TestListQuerySelects(t *testing.T) {
+	meta := &Meta{
+		Owner:     "alice",
+		Grant:     []Grant{{Login: "bob", Permission: PermissionWrite}},
+		Inherited: []Grant{{Login: "carol", Permission: PermissionRead}},
+	}
+
+	tests := []struct {
+		name  string
+		q     ListQuery
+		want  bool
+	}{
+		{"owner", ListQuery{Owner: "alice"}, true},
+		{"other owner", ListQuery{Owner: "bob"}, false},
+		{"granted", ListQuery{Owner: "bob", Login: "bob"}, true},
+		{"granted by folder", ListQuery{Owner: "carol", Login: "carol"}, true},
+		{"owned is not shared", ListQuery{Owner: "alice", Login: "alice"}, false},
+		{"not granted", ListQuery{Owner: "dave", Login: "dave"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.q.Selects(meta); got != test.want {
+				t.Errorf("Selects = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestListQueryMatch(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	meta := &Meta{
+		Owner:     "alice",
+		Name:      "report.pdf",
+		Mime:      "application/pdf",
+		File:      true,
+		Ts:        created.UnixNano(),
+		Size:      1000,
+		ParentID:  "folder",
+		Tags:      []string{"q1", "finance"},
+		Metadata:  map[string]string{"project": "apollo"},
+	}
+
+	tests := []struct {
+		name  string
+		q     ListQuery
+		want  bool
+	}{
+		{"no filters", ListQuery{}, true},
+		{"other owner", ListQuery{Owner: "bob"}, false},
+		{"name", ListQuery{Name: ptr("report.pdf")}, true},
+		{"other name", ListQuery{Name: ptr("report")}, false},
+		{"name prefix", ListQuery{NamePrefix: ptr("rep")}, true},
+		{"other prefix", ListQuery{NamePrefix: ptr("pdf")}, false},
+		{"mime", ListQuery{Mime: ptr("application/pdf")}, true},
+		{"other mime", ListQuery{Mime: ptr("text/plain")}, false},
+		{"file", ListQuery{File: ptr(true)}, true},
+		{"json", ListQuery{File: ptr(false)}, false},
+		{"public", ListQuery{Public: ptr(true)}, false},
+		{"created after inclusive", ListQuery{CreatedAfter: ptr(created)}, true},
+		{"created after", ListQuery{CreatedAfter: ptr(created.Add(time.Second))}, false},
+		{"created before exclusive", ListQuery{CreatedBefore: ptr(created)}, false},
+		{"created before", ListQuery{CreatedBefore: ptr(created.Add(time.Second))}, true},
+		{"min size inclusive", ListQuery{MinSize: ptr(int64(1000))}, true},
+		{"min size", ListQuery{MinSize: ptr(int64(1001))}, false},
+		{"max size inclusive", ListQuery{MaxSize: ptr(int64(1000))}, true},
+		{"max size", ListQuery{MaxSize: ptr(int64(999))}, false},
+		{"folder", ListQuery{ParentID: ptr("folder")}, true},
+		{"root", ListQuery{ParentID: ptr("")}, false},
+		{"tags", ListQuery{Tags: []string{"finance", "q1"}}, true},
+		{"missing tag", ListQuery{Tags: []string{"q1", "q2"}}, false},
+		{"metadata", ListQuery{Metadata: map[string]string{"project": "apollo"}}, true},
+		{"other metadata", ListQuery{Metadata: map[string]string{"project": "gemini"}}, false},
+		{"all filters", ListQuery{Name: ptr("report.pdf"), File: ptr(true), MaxSize: ptr(int64(2000)), Tags: []string{"q1"}}, true},
+		{"one filter fails", ListQuery{Name: ptr("report.pdf"), File: ptr(false)}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := test.q
+			if q.Owner == "" {
+				q.Owner = "alice"
+			}
+			if got := q.Match(meta); got != test.want {
+				t.Errorf("Match = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	expired := *meta
+	expired.ExpiresTs = time.Now().Add(-time.Minute).Unix()
+	if (&ListQuery{Owner: "alice"}).Match(&expired) {
+		t.Error("expired document matched")
+	}
+}
+
+// TestListQueryPages lists documents page by page with cursors,
+// every document must come once and in sort order
+func TestListQueryPages(t *testing.T) {
+	metas := []*Meta{
+		{ID: "a", Name: "x", Ts: 3, UpdatedTs: 1, Size: 10},
+		{ID: "b", Name: "x", Ts: 1, UpdatedTs: 2, Size: 10},
+		{ID: "c", Name: "w", Ts: 2, UpdatedTs: 2, Size: 5},
+		{ID: "d", Name: "z", Ts: 2, UpdatedTs: 3, Size: 20},
+		{ID: "e", Name: "y", Ts: 5, UpdatedTs: 1, Size: 10},
+	}
+
+	tests := []struct {
+		sort  string
+		desc  bool
+		want  string
+	}{
+		{SortCreated, false, "bcdae"},
+		{SortCreated, true, "eadcb"},
+		{SortUpdated, false, "aebcd"},
+		{SortName, false, "cabed"},
+		{SortName, true, "debac"},
+		{SortSize, false, "cabed"},
+		{SortSize, true, "debac"},
+	}
+
+	for _, test := range tests {
+		for limit := 1; limit <= len(metas); limit++ {
+			q := &ListQuery{Sort: test.sort, Desc: test.desc, Limit: limit}
+
+			var got string
+			for pages := 0; pages <= len(metas); pages++ {
+				page := make([]*Meta, 0)
+				for _, meta := range metas {
+					if q.After(meta) {
+						page = append(page, meta)
+					}
+				}
+				sort.Slice(page, func(i, j int) bool {
+					return q.Less(page[i], page[j])
+				})
+				if len(page) > limit {
+					page = page[:limit]
+				}
+				if len(page) == 0 {
+					break
+				}
+				for _, meta := range page {
+					got += meta.ID
+				}
+
+				cursor, err := ParseCursor(q.NextCursor(page[len(page)-1]), q.Sort, q.Desc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				q.Cursor = cursor
+			}
+
+			if got != test.want {
+				t.Errorf("sort %s desc %v limit %d: listed %q, want %q", test.sort, test.desc, limit, got, test.want)
+			}
+		}
+	}
+}
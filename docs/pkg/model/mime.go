@@ -0,0 +1,121 @@
+package model
+
+import (
+	"mime"
+	"strings"
+	"net/http"
+	"path/filepath"
+)
+
+// SniffLen is how many first bytes of content DetectMime looks at
+const SniffLen = 512
+
+// extensionTypes refine types content sniffing can not tell apart,
+// e.g. office documents are zip archives to http.DetectContentType.
+// An extension applies only to content sniffed as its container type
+var extensionTypes = map[string]struct{ mime, sniffed string }{
+	".csv":  {"text/csv", "text/plain"},
+	".md":   {"text/markdown", "text/plain"},
+	".json": {"application/json", "text/plain"},
+	".yaml": {"application/yaml", "text/plain"},
+	".yml":  {"application/yaml", "text/plain"},
+	".svg":  {"image/svg+xml", "text/xml"},
+	".docx": {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/zip"},
+	".xlsx": {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "application/zip"},
+	".pptx": {"application/vnd.openxmlformats-officedocument.presentationml.presentation", "application/zip"},
+	".odt":  {"application/vnd.oasis.opendocument.text", "application/zip"},
+	".ods":  {"application/vnd.oasis.opendocument.spreadsheet", "application/zip"},
+	".odp":  {"application/vnd.oasis.opendocument.presentation", "application/zip"},
+	".epub": {"application/epub+zip", "application/zip"},
+	".doc":  {"application/msword", "application/octet-stream"},
+	".xls":  {"application/vnd.ms-excel", "application/octet-stream"},
+	".ppt":  {"application/vnd.ms-powerpoint", "application/octet-stream"},
+}
+
+// DetectMime tells content type by head of content, name extension
+// makes it more specific where content alone is ambiguous
+func DetectMime(head []byte, name string) string {
+	detected := http.DetectContentType(head)
+
+	ext, ok := extensionTypes[strings.ToLower(filepath.Ext(name))]
+	if ok && ext.sniffed == BaseMime(detected) {
+		return ext.mime
+	}
+
+	return detected
+}
+
+// BaseMime drops parameters, as charset, and lowercases media type
+func BaseMime(value string) string {
+	base, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		base, _, _ = strings.Cut(value, ";")
+		return strings.ToLower(strings.TrimSpace(base))
+	}
+	return base
+}
+
+// TextMime tells if content of type is text, words of
+// text documents are searchable
+func TextMime(value string) bool {
+	base := BaseMime(value)
+
+	switch {
+	case strings.HasPrefix(base, "text/"):
+		return true
+	case strings.HasSuffix(base, "+json"), strings.HasSuffix(base, "+xml"):
+		return true
+	}
+
+	switch base {
+	case "application/json", "application/xml", "application/yaml", "application/x-yaml":
+		return true
+	}
+	return false
+}
+
+// MimePolicy limits types documents may have, Deny wins over Allow.
+// Entries are media types or type/* wildcards, empty Allow allows all
+type MimePolicy struct {
+	Allow  []string
+	Deny   []string
+}
+
+func (p MimePolicy) Permits(value string) bool {
+	base := BaseMime(value)
+
+	if matchMime(p.Deny, base) {
+		return false
+	}
+
+	return len(p.Allow) == 0 || matchMime(p.Allow, base)
+}
+
+func matchMime(patterns []string, base string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == base || pattern == "*/*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(base, prefix + "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ContentType is the type document is served with,
+// detected one unless content was not sniffed
+func (m *Meta) ContentType() string {
+	if m.Detected != "" {
+		return m.Detected
+	}
+	return m.Mime
+}
+
+func (v *Version) ContentType() string {
+	if v.Detected != "" {
+		return v.Detected
+	}
+	return v.Mime
+}
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestDetectMime(t *testing.T) {
+	zip := []byte("PK\x03\x04\x14\x00\x00\x00\x08\x00")
+	text := []byte("plain words\n")
+
+	tests := []struct {
+		name   string
+		head   []byte
+		file   string
+		want   string
+	}{
+		{"text", text, "notes", "text/plain; charset=utf-8"},
+		{"markdown", text, "README.md", "text/markdown"},
+		{"csv", []byte("a,b\n1,2\n"), "table.csv", "text/csv"},
+		{"extension case", text, "CONFIG.YML", "application/yaml"},
+		{"pdf", []byte("%PDF-1.7\n"), "paper.pdf", "application/pdf"},
+		{"zip", zip, "archive.zip", "application/zip"},
+		{"docx sniffed as zip", zip, "letter.docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"xlsx sniffed as zip", zip, "sheet.xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		{"odt sniffed as zip", zip, "letter.odt", "application/vnd.oasis.opendocument.text"},
+		{"docx of text", text, "letter.docx", "text/plain; charset=utf-8"},
+		{"markdown of zip", zip, "README.md", "application/zip"},
+		{"svg", []byte("<?xml version=\"1.0\"?><svg/>"), "logo.svg", "image/svg+xml"},
+		{"legacy office", []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1\x00"), "old.doc", "application/msword"},
+		{"empty", nil, "empty", "text/plain; charset=utf-8"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := DetectMime(test.head, test.file); got != test.want {
+				t.Errorf("DetectMime(%q, %q) = %q, want %q", test.head, test.file, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMimePolicyPermits(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  MimePolicy
+		value   string
+		want    bool
+	}{
+		{"empty policy", MimePolicy{}, "application/x-msdownload", true},
+		{"allowed", MimePolicy{Allow: []string{"application/pdf"}}, "application/pdf", true},
+		{"not allowed", MimePolicy{Allow: []string{"application/pdf"}}, "text/plain", false},
+		{"wildcard", MimePolicy{Allow: []string{"image/*"}}, "image/png", true},
+		{"wildcard of other type", MimePolicy{Allow: []string{"image/*"}}, "text/plain", false},
+		{"any type", MimePolicy{Allow: []string{"*/*"}}, "video/mp4", true},
+		{"denied", MimePolicy{Deny: []string{"application/x-msdownload"}}, "application/x-msdownload", false},
+		{"deny wins over allow", MimePolicy{Allow: []string{"application/x-sh"}, Deny: []string{"application/x-sh"}}, "application/x-sh", false},
+		{"deny wins over wildcard", MimePolicy{Allow: []string{"*/*"}, Deny: []string{"text/html"}}, "text/html", false},
+		{"wildcard deny wins", MimePolicy{Allow: []string{"image/svg+xml"}, Deny: []string{"image/*"}}, "image/svg+xml", false},
+		{"others pass deny", MimePolicy{Deny: []string{"text/html"}}, "text/plain", true},
+		{"parameters dropped", MimePolicy{Allow: []string{"text/plain"}}, "text/plain; charset=utf-8", true},
+		{"parameters of denied", MimePolicy{Deny: []string{"text/html"}}, "Text/HTML; charset=utf-8", false},
+		{"malformed parameters", MimePolicy{Deny: []string{"text/html"}}, "text/html; charset", false},
+		{"patterns cleaned", MimePolicy{Allow: []string{" Application/PDF "}}, "application/pdf", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.Permits(test.value); got != test.want {
+				t.Errorf("Permits(%q) = %v, want %v", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMatchMime(t *testing.T) {
+	tests := []struct {
+		patterns  []string
+		base      string
+		want      bool
+	}{
+		{nil, "text/plain", false},
+		{[]string{"text/plain"}, "text/plain", true},
+		{[]string{"text/html", "text/plain"}, "text/plain", true},
+		{[]string{"text/*"}, "text/csv", true},
+		{[]string{"text/*"}, "textual/csv", false},
+		{[]string{"text/*"}, "text", false},
+		{[]string{"text"}, "text/plain", false},
+		{[]string{"*/*"}, "application/zip", true},
+		{[]string{"application/*"}, "application/vnd.ms-excel", true},
+		{[]string{"application/zip"}, "application/epub+zip", false},
+	}
+
+	for _, test := range tests {
+		if got := matchMime(test.patterns, test.base); got != test.want {
+			t.Errorf("matchMime(%q, %q) = %v, want %v", test.patterns, test.base, got, test.want)
+		}
+	}
+}
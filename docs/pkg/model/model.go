@@ -5,15 +5,31 @@ import "encoding/json"
 type (
 	Meta struct {
 		ID        string            `json:"id"`
-		Oid       uint32            `json:"-"`
+		Blob      string            `json:"-"`
+		SHA256    string            `json:"sha256,omitempty"`
 		Name      string            `json:"name"`
 		Mime      string            `json:"mime"`
+		Detected  string            `json:"detected_mime,omitempty"`
 		File      bool              `json:"file"`
 		Public    bool              `json:"public"`
+		Owner     string            `json:"owner"`
 		Created   string            `json:"created"`
+		Updated   string            `json:"updated"`
 		Ts        int64             `json:"-"`
+		UpdatedTs int64             `json:"-"`
 		Size      int64             `json:"-"`
-		Grant     []string          `json:"grant"`
+		Grant     []Grant           `json:"grant"`
+		Version   int               `json:"version"`
+		MaxVersions *int            `json:"max_versions,omitempty"`
+		Revision  int64             `json:"revision"`
+		Schema    string            `json:"schema,omitempty"` // name of owner schema json is validated with
+		ParentID  string            `json:"parent_id,omitempty"` // folder, root if empty
+		Inherited []Grant           `json:"inherited_grant,omitempty"` // grants of folders above
+		Tags      []string          `json:"tags,omitempty"`
+		Metadata  map[string]string `json:"metadata,omitempty"` // user defined key values
+		Deleted   string            `json:"deleted,omitempty"` // when moved to trash
+		Expires   string            `json:"expires_at,omitempty"`
+		ExpiresTs int64             `json:"-"` // unix seconds, never expires if zero
 	}
 
 	SaveMeta struct {
@@ -23,7 +39,87 @@ type (
 		Public    bool              `json:"public"`
 		Token     string            `json:"token"`
 		Mime      string            `json:"mime"`
-		Grant     []string          `json:"grant"`
+		Grant     []Grant           `json:"grant"`
+		MaxVersions *int            `json:"max_versions"`
+		SHA256    string            `json:"sha256"` // expected hex digest of file, optional
+		Schema    string            `json:"schema"`
+		ParentID  string            `json:"parent_id"`
+		Tags      []string          `json:"tags"`
+		Metadata  map[string]string `json:"metadata"`
+		Expires   string            `json:"expires_at"` // RFC 3339, document is removed after
+	}
+
+	// UpdateMeta holds fields to change, nil fields are left as is
+	UpdateMeta struct {
+		Token     string            `json:"token"`
+		Name      *string           `json:"name"`
+		Mime      *string           `json:"mime"`
+		Public    *bool             `json:"public"`
+		Grant     []Grant           `json:"grant"`
+		MaxVersions *int            `json:"max_versions"`
+		Schema    *string           `json:"schema"` // empty detaches schema
+		ParentID  *string           `json:"parent_id"` // empty moves to root
+		Tags      *[]string         `json:"tags"` // replaces all tags
+		Metadata  *map[string]string `json:"metadata"` // replaces all key values
+		Expires   *string           `json:"expires_at"` // empty keeps document forever
+	}
+
+	// Version is a previous content of a document
+	Version struct {
+		Version   int               `json:"version"`
+		Blob      string            `json:"-"`
+		SHA256    string            `json:"sha256,omitempty"`
+		Name      string            `json:"name"`
+		Mime      string            `json:"mime"`
+		Detected  string            `json:"detected_mime,omitempty"`
+		File      bool              `json:"file"`
+		Size      int64             `json:"size"`
+		Created   string            `json:"created"`
+		Archived  string            `json:"archived"`
+	}
+
+	VersionsResponse struct {
+		Current   int               `json:"current"`
+		Versions  []*Version        `json:"versions"`
+	}
+
+	Link struct {
+		ID            string        `json:"id"`
+		DocID         string        `json:"doc_id"`
+		Owner         string        `json:"owner"`
+		URL           string        `json:"url,omitempty"`
+		Expires       string        `json:"expires"`
+		ExpiresTs     int64         `json:"-"`
+		MaxDownloads  int           `json:"max_downloads,omitempty"`
+		Downloads     int           `json:"downloads"`
+		Password      bool          `json:"password"`
+		Revoked       bool          `json:"revoked"`
+		Created       string        `json:"created"`
+	}
+
+	LinksResponse struct {
+		Links   []*Link             `json:"links"`
+	}
+
+	// Upload is a resumable file upload session, document DocID
+	// is created when Offset reaches Length
+	Upload struct {
+		ID            string        `json:"id"`
+		DocID         string        `json:"doc_id"`
+		Chunks        []string      `json:"-"`
+		Owner         string        `json:"owner"`
+		Name          string        `json:"name"`
+		Mime          string        `json:"mime"`
+		Public        bool          `json:"public"`
+		Length        int64         `json:"length"`
+		Offset        int64         `json:"offset"`
+		Expires       string        `json:"expires"`
+		ExpiresTs     int64         `json:"-"`
+		Created       string        `json:"created"`
+		ParentID      string        `json:"parent_id,omitempty"` // folder of the document
+		Tags          []string      `json:"tags,omitempty"`
+		Metadata      map[string]string `json:"metadata,omitempty"`
+		DocExpiresTs  int64         `json:"-"` // unix seconds document expires at, never if zero
 	}
 
 	ListMeta struct {
@@ -36,12 +132,27 @@ type (
 
 	DeleteResponse map[string]interface{}
 
+	// SearchResult is a document found by its words, Snippet is
+	// html: escaped text around matches, which are put in <mark></mark>
+	SearchResult struct {
+		Doc     *Meta               `json:"doc"`
+		Rank    float32             `json:"rank"`
+		Snippet string              `json:"snippet"`
+	}
+
+	SearchResponse struct {
+		Results []*SearchResult     `json:"results"`
+	}
+
 	ListResponse struct {
 		Docs    []*Meta             `json:"docs"`
+		NextCursor string           `json:"next_cursor,omitempty"`
 	}
 
 	SaveResponse struct {
+		ID      string              `json:"id,omitempty"`
 		JSON    json.RawMessage     `json:"json,omitempty"`
 		File    string              `json:"file,omitempty"`
+		SHA256  string              `json:"sha256,omitempty"`
 	}
 )
\ No newline at end of file
@@ -0,0 +1,18 @@
+package model
+
+// Media types json documents may be patched with
+const (
+	PatchJSON  = "application/json-patch+json"  // RFC 6902
+	PatchMerge = "application/merge-patch+json" // RFC 7396
+)
+
+// AcceptPatch is Accept-Patch header value, RFC 5789
+const AcceptPatch = PatchJSON + ", " + PatchMerge
+
+func PatchType(value string) bool {
+	switch BaseMime(value) {
+	case PatchJSON, PatchMerge:
+		return true
+	}
+	return false
+}
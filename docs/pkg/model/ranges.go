@@ -0,0 +1,134 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxRanges bounds ranges of one request, more ask for the whole content
+const maxRanges = 16
+
+// ByteRange is a resolved part of file content, Length bytes from Start
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange formats range for Content-Range header
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange resolves "bytes=" Range header against content size.
+// Ranges that start past the end are dropped, if none left ErrBadRange is returned.
+// Overlapping or adjacent ranges are coalesced in order of start. No ranges and
+// no error, as net/http ServeContent does, mean the whole content is to be sent:
+// for more than maxRanges ranges or ranges covering more bytes than content has
+func ParseRange(header string, size int64) ([]ByteRange, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil, ErrBadRange
+	}
+
+	var ranges []ByteRange
+	var parts int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		parts++
+		if parts > maxRanges {
+			return nil, nil
+		}
+
+		first, last, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, ErrBadRange
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		var r ByteRange
+		if first == "" {
+			// suffix range, last n bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, ErrBadRange
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r.Start = size - n
+			r.Length = n
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, ErrBadRange
+			}
+			if start >= size {
+				continue
+			}
+
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, ErrBadRange
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			r.Start = start
+			r.Length = end - start + 1
+		}
+
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 0 {
+		return nil, ErrBadRange
+	}
+
+	var total int64
+	for _, r := range ranges {
+		total += r.Length
+	}
+	if total > size {
+		return nil, nil
+	}
+
+	return coalesce(ranges), nil
+}
+
+// coalesce merges overlapping and adjacent ranges, which are
+// sorted by start then. Ranges all apart keep order they came in
+func coalesce(ranges []ByteRange) []ByteRange {
+	sorted := append([]ByteRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	merged := []ByteRange{sorted[0]}
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start > last.Start + last.Length {
+			merged = append(merged, r)
+			continue
+		}
+		if end := r.Start + r.Length; end > last.Start + last.Length {
+			last.Length = end - last.Start
+		}
+	}
+
+	if len(merged) == len(ranges) {
+		return ranges
+	}
+	return merged
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"testing"
+	"reflect"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		size    int64
+		want    []ByteRange
+		err     error
+	}{
+		{"first bytes", "bytes=0-99", 1000, []ByteRange{{0, 100}}, nil},
+		{"middle", "bytes=100-199", 1000, []ByteRange{{100, 100}}, nil},
+		{"single byte", "bytes=5-5", 1000, []ByteRange{{5, 1}}, nil},
+		{"open end", "bytes=900-", 1000, []ByteRange{{900, 100}}, nil},
+		{"end past size", "bytes=900-5000", 1000, []ByteRange{{900, 100}}, nil},
+		{"suffix", "bytes=-100", 1000, []ByteRange{{900, 100}}, nil},
+		{"suffix past size", "bytes=-5000", 1000, []ByteRange{{0, 1000}}, nil},
+		{"several", "bytes=0-0, -1", 1000, []ByteRange{{0, 1}, {999, 1}}, nil},
+		{"spaces", "bytes= 0 - 9 ,", 1000, []ByteRange{{0, 10}}, nil},
+		{"unsatisfiable dropped", "bytes=2000-3000, 0-9", 1000, []ByteRange{{0, 10}}, nil},
+		{"apart keep order", "bytes=500-509, 0-9", 1000, []ByteRange{{500, 10}, {0, 10}}, nil},
+		{"overlapping coalesced", "bytes=50-99, 0-59", 1000, []ByteRange{{0, 100}}, nil},
+		{"adjacent coalesced", "bytes=0-9, 10-19, 30-39", 1000, []ByteRange{{0, 20}, {30, 10}}, nil},
+		{"contained coalesced", "bytes=0-99, 10-19", 1000, []ByteRange{{0, 100}}, nil},
+		{"repeated ranges", "bytes=0-99, 0-99", 1000, []ByteRange{{0, 100}}, nil},
+		{"more than content", "bytes=0-, 0-, 0-", 1000, nil, nil},
+		{"suffix and open overlap", "bytes=-600, 0-599", 1000, nil, nil},
+		{"many ranges", "bytes=0-0,2-2,4-4,6-6,8-8,10-10,12-12,14-14,16-16,18-18,20-20,22-22,24-24,26-26,28-28,30-30,32-32", 1000, nil, nil},
+		{"most ranges", "bytes=0-0,2-2,4-4,6-6,8-8,10-10,12-12,14-14,16-16,18-18,20-20,22-22,24-24,26-26,28-28,30-30", 1000,
+			[]ByteRange{{0, 1}, {2, 1}, {4, 1}, {6, 1}, {8, 1}, {10, 1}, {12, 1}, {14, 1}, {16, 1}, {18, 1}, {20, 1}, {22, 1}, {24, 1}, {26, 1}, {28, 1}, {30, 1}}, nil},
+		{"start past size", "bytes=1000-", 1000, nil, ErrBadRange},
+		{"zero suffix", "bytes=-0", 1000, nil, ErrBadRange},
+		{"empty content", "bytes=0-", 0, nil, ErrBadRange},
+		{"suffix of empty content", "bytes=-10", 0, nil, ErrBadRange},
+		{"other unit", "items=0-9", 1000, nil, ErrBadRange},
+		{"no dash", "bytes=10", 1000, nil, ErrBadRange},
+		{"end before start", "bytes=10-5", 1000, nil, ErrBadRange},
+		{"negative", "bytes=-5-10", 1000, nil, ErrBadRange},
+		{"not a number", "bytes=a-b", 1000, nil, ErrBadRange},
+		{"empty set", "bytes=", 1000, nil, ErrBadRange},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseRange(test.header, test.size)
+			if err != test.err {
+				t.Fatalf("ParseRange(%q, %d) error %v, want %v", test.header, test.size, err, test.err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseRange(%q, %d) = %v, want %v", test.header, test.size, got, test.want)
+			}
+		})
+	}
+}
+
+func TestContentRange(t *testing.T) {
+	got := ByteRange{Start: 900, Length: 100}.ContentRange(1000)
+	if got != "bytes 900-999/1000" {
+		t.Errorf("ContentRange = %q", got)
+	}
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"fmt"
+	"encoding/json"
+)
+
+// Schema is a JSON Schema, draft 2020-12, owner validates json
+// documents with. Default one applies to owner documents naming none
+type Schema struct {
+	Name     string           `json:"name"`
+	Owner    string           `json:"owner"`
+	Schema   json.RawMessage  `json:"schema"`
+	Default  bool             `json:"default"`
+	Created  string           `json:"created"`
+	Updated  string           `json:"updated"`
+}
+
+type SchemasResponse struct {
+	Schemas  []*Schema        `json:"schemas"`
+}
+
+// Violation is a place of json document failing its schema,
+// Path is json pointer into document, Keyword is the one failed
+type Violation struct {
+	Path     string   `json:"path"`
+	Keyword  string   `json:"keyword"`
+	Text     string   `json:"text"`
+}
+
+// SchemaError lists violations of document, it is ErrSchemaViolation
+type SchemaError struct {
+	Schema      string
+	Violations  []Violation
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%v: %d violations of schema %q", ErrSchemaViolation, len(e.Violations), e.Schema)
+}
+
+func (e *SchemaError) Unwrap() error {
+	return ErrSchemaViolation
+}
@@ -0,0 +1,81 @@
+package model
+
+import "fmt"
+
+const (
+	maxTags          = 64
+	maxTagSize       = 256
+	maxMetadata      = 64
+	maxMetadataKey   = 256
+	maxMetadataValue = 4096
+)
+
+// CleanTags checks tags and drops repeated ones, order is kept.
+// Errors wrap ErrBadMetadata
+func CleanTags(tags []string) ([]string, error) {
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("%w: more than %d tags", ErrBadMetadata, maxTags)
+	}
+
+	seen := make(map[string]bool, len(tags))
+	clean := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag == "" || len(tag) > maxTagSize {
+			return nil, fmt.Errorf("%w: tag must be 1 to %d bytes", ErrBadMetadata, maxTagSize)
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+
+		clean = append(clean, tag)
+	}
+
+	return clean, nil
+}
+
+// CheckMetadata checks sizes of user defined key values.
+// Errors wrap ErrBadMetadata
+func CheckMetadata(metadata map[string]string) error {
+	if len(metadata) > maxMetadata {
+		return fmt.Errorf("%w: more than %d metadata keys", ErrBadMetadata, maxMetadata)
+	}
+
+	for key, value := range metadata {
+		if key == "" || len(key) > maxMetadataKey {
+			return fmt.Errorf("%w: metadata key must be 1 to %d bytes", ErrBadMetadata, maxMetadataKey)
+		}
+		if len(value) > maxMetadataValue {
+			return fmt.Errorf("%w: metadata value of %q over %d bytes", ErrBadMetadata, key, maxMetadataValue)
+		}
+	}
+
+	return nil
+}
+
+// HasTags tells if document is tagged with all of tags
+func (m *Meta) HasTags(tags []string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, t := range m.Tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// HasMetadata tells if document has all of key values
+func (m *Meta) HasMetadata(metadata map[string]string) bool {
+	for key, value := range metadata {
+		if v, ok := m.Metadata[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
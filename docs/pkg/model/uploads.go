@@ -0,0 +1,17 @@
+package model
+
+// Doc is meta of document upload becomes, fields client gave only
+func (u *Upload) Doc() *Meta {
+	return &Meta{
+		ID:        u.DocID,
+		Name:      u.Name,
+		Mime:      u.Mime,
+		File:      true,
+		Public:    u.Public,
+		Owner:     u.Owner,
+		ParentID:  u.ParentID,
+		Tags:      u.Tags,
+		Metadata:  u.Metadata,
+		ExpiresTs: u.DocExpiresTs,
+	}
+}
@@ -17,14 +17,14 @@ func Dial(ctx context.Context, endpoint string) (conn *grpc.ClientConn, err erro
 	defer func() {
 		if err != nil {
 			if err = conn.Close(); err != nil {
-				fmt.Fprintf(os.Stderr, "error closing grpc conn: %w", err)
+				fmt.Fprintf(os.Stderr, "error closing grpc conn: %v", err)
 			}
 			return
 		}
 		go func() {
 			<-ctx.Done()
 			if err = conn.Close(); err != nil {
-				fmt.Fprintf(os.Stderr, "error closing grpc conn: %w", err)
+				fmt.Fprintf(os.Stderr, "error closing grpc conn: %v", err)
 			}
 		}()
 	}()
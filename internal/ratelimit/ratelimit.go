@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter counts requests per key in fixed time windows
+type Limiter struct {
+	mu       sync.Mutex
+	limit    int
+	window   time.Duration
+	start    time.Time
+	counts   map[string]int
+}
+
+func New(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		window:  window,
+		start:   time.Now(),
+		counts:  make(map[string]int, 0),
+	}
+}
+
+// Allow reports if one more request for key fits current window.
+// Zero or negative limit disables limiting
+func (l *Limiter) Allow(key string) bool {
+	if l.limit <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.start) >= l.window {
+		l.start = now
+		l.counts = make(map[string]int, 0)
+	}
+
+	if l.counts[key] >= l.limit {
+		return false
+	}
+
+	l.counts[key] += 1
+	return true
+}
+
+// RetryAfter is time left until current window resets
+func (l *Limiter) RetryAfter() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.window - time.Since(l.start)
+}
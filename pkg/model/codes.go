@@ -6,4 +6,5 @@ var (
 	CodeWrongPassword      int = 13
 	CodeNoToken            int = 14
 	CodeNoForm             int = 15
+	CodeTooManyRequests    int = 16
 )
\ No newline at end of file
@@ -6,6 +6,14 @@ type (
 	ErrorCode struct {
 		Code    int         `json:"code"`
 		Text    string      `json:"text"`
+		Details []ErrorDetail `json:"details,omitempty"`
+	}
+
+	// ErrorDetail points at a part of request at fault, e.g. with json pointer
+	ErrorDetail struct {
+		Path    string      `json:"path"`
+		Reason  string      `json:"reason,omitempty"`
+		Text    string      `json:"text"`
 	}
 
 	ServerResponse struct {
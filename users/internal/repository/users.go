@@ -70,7 +70,7 @@ func (r Repository) Forget(ctx context.Context, token string) (login string, err
 			if errors.Is(err, model.ErrNoUser) {
 				return
 			} else {
-				fmt.Fprintf(os.Stderr, "rollback with error: %w", err)
+				fmt.Fprintf(os.Stderr, "rollback with error: %v", err)
 				err = tx.Rollback(ctx)
 			}
 		default: